@@ -6,9 +6,17 @@ SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
 DROP TABLE IF EXISTS `sessions`;
 CREATE TABLE `sessions` (
                          `id` int(11) NOT NULL AUTO_INCREMENT,
-                         `data` text NOT NULL,
+                         `data` char(32) NOT NULL,
                          `userID` text NOT NULL,
-                         PRIMARY KEY (`id`)
+                         `refresh` char(64) NOT NULL DEFAULT '',
+                         `created_at` bigint NOT NULL DEFAULT 0,
+                         `user_agent` varchar(255) NOT NULL DEFAULT '',
+                         `ip` varchar(45) NOT NULL DEFAULT '',
+                         `last_seen` bigint NOT NULL DEFAULT 0,
+                         `expires_at` bigint NOT NULL DEFAULT 0,
+                         PRIMARY KEY (`id`),
+                         UNIQUE KEY `data` (`data`),
+                         KEY `expires_at` (`expires_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 INSERT INTO `sessions` (`id`, `data`, `userID`) VALUES
@@ -2,101 +2,155 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"flag"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"redditclone/pkg/apierror"
+	"redditclone/pkg/config"
 	"redditclone/pkg/handler"
+	"redditclone/pkg/health"
+	"redditclone/pkg/metrics"
 	"redditclone/pkg/middleware"
 	"redditclone/pkg/repo"
+	"redditclone/pkg/server"
 	"redditclone/pkg/session"
-	"redditclone/pkg/user"
+	"redditclone/pkg/views"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	// основные настройки к базе
-	dsn := "root:love@tcp(localhost:3306)/golang?"
-	dsn += "charset=utf8"
-	dsn += "&interpolateParams=true"
-
-	db, err := sql.Open("mysql", dsn)
-	db.SetMaxOpenConns(10)
-	err = db.Ping() // проверяем подключение
-	if err != nil {
-		panic(err)
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if err == flag.ErrHelp {
+		return
 	}
-	log.Println("Connected to MySQL!")
-
-	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:27017"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = client.Connect(context.TODO())
+	zapLogger, errZap := zap.NewProduction() //create logger
+	if errZap != nil {
+		log.Println("Error in creation zapLogger")
+	}
+	logger := zapLogger.Sugar()
+
+	srv := &server.Server{
+		HTTP: &http.Server{
+			Addr:         cfg.Addr,
+			ReadTimeout:  cfg.HTTP.ReadTimeout,
+			WriteTimeout: cfg.HTTP.WriteTimeout,
+			IdleTimeout:  cfg.HTTP.IdleTimeout,
+		},
+		DrainDelay:      cfg.HTTP.DrainDelay,
+		ShutdownTimeout: cfg.HTTP.ShutdownTimeout,
+		Logger:          logger,
+	}
+	st, err := openStores(cfg, logger, srv.OnShutdown)
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = client.Ping(context.TODO(), nil)
+	srv.OnShutdown("logger", func(ctx context.Context) error {
+		return zapLogger.Sync()
+	})
+
+	apiHandler, err := newHandler(cfg, st, logger, prometheus.NewRegistry(), srv.Draining)
 	if err != nil {
 		log.Fatal(err)
 	}
+	srv.HTTP.Handler = apiHandler
 
-	log.Println("Connected to MongoDB!")
-	collection := client.Database("coursera").Collection("posts")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	fmt.Println("starting server at", cfg.Addr)
+	errRun := srv.Run(ctx)
+	if errRun != nil {
+		log.Println("err in run", errRun)
+		return
+	}
+}
 
-	zapLogger, errZap := zap.NewProduction() //create logger
-	if errZap != nil {
-		log.Println("Error in creation zapLogger")
+// newHandler builds the API over the stores with the middleware around it.
+// The metrics are collected in registry and draining is reported by /readyz.
+func newHandler(cfg *config.Config, st *stores, logger *zap.SugaredLogger, registry *prometheus.Registry, draining func() bool) (http.Handler, error) {
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		return nil, err
 	}
-	defer func(zapLogger *zap.Logger) {
-		err := zapLogger.Sync()
-		if err != nil {
-			log.Println(err)
-		}
-	}(zapLogger)
-	logger := zapLogger.Sugar()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	appMetrics := metrics.New(registry)
 
-	userRepo := user.NewMysqlRepo(db)
-	postRepo := repo.NewMongoRepo(collection)
-	sessRepo := session.NewSessionsRepo(db)
+	sessRepo := metrics.NewSessRepo(st.sessions, appMetrics)
 	userHandler := &handler.UserHandler{
-		UserRepo: userRepo,
-		Logger:   logger,
-		Sessions: sessRepo,
+		UserRepo:    metrics.NewUserRepo(st.users, appMetrics),
+		Logger:      logger,
+		Sessions:    sessRepo,
+		TokenSecret: []byte(cfg.Auth.Secret),
+		TokenTTL:    cfg.Auth.TokenTTL,
 	}
 	postHandler := &handler.PostHandler{
-		PostRepo: repo.NewPostDB(postRepo),
+		PostRepo: metrics.NewPostRepo(repo.NewPostDB(st.posts, st.ids), appMetrics),
 		Logger:   logger,
 		Sessions: sessRepo,
+		Views:    views.NewTracker(cfg.Posts.ViewsWindow),
 	}
 
 	r := mux.NewRouter()
-	r.HandleFunc("/api/posts", postHandler.Add).Methods("POST")
+	r.Handle("/api/posts", middleware.RequireAuth(http.HandlerFunc(postHandler.Add))).Methods("POST")
 	r.HandleFunc("/api/posts/{CATEGORY_NAME}", postHandler.Category).Methods("GET")
 	r.HandleFunc("/api/post/{POST_ID}", postHandler.Get).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}", postHandler.AddComment).Methods("POST")
-	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", postHandler.DeleteComment).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}", middleware.RequireAuth(http.HandlerFunc(postHandler.AddComment))).Methods("POST")
+	r.Handle("/api/post/{POST_ID}", middleware.RequireAuth(handler.OnlyOwner(postHandler.PostOwner, postHandler.Update))).Methods("PUT")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}", middleware.RequireAuth(http.HandlerFunc(postHandler.Reply))).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}", middleware.RequireAuth(handler.OnlyOwner(postHandler.CommentOwner, postHandler.EditComment))).Methods("PUT")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}", middleware.RequireAuth(handler.OnlyOwner(postHandler.CommentOwner, postHandler.DeleteComment))).Methods("DELETE")
 	r.HandleFunc("/api/posts/", postHandler.List).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/upvote", postHandler.Upvote).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/downvote", postHandler.Downvote).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/unvote", postHandler.Unvote).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}", postHandler.DeletePost).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}/upvote", middleware.RequireAuth(http.HandlerFunc(postHandler.Upvote))).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/downvote", middleware.RequireAuth(http.HandlerFunc(postHandler.Downvote))).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/unvote", middleware.RequireAuth(http.HandlerFunc(postHandler.Unvote))).Methods("GET")
+	r.Handle("/api/post/{POST_ID}", middleware.RequireAuth(handler.OnlyOwner(postHandler.PostOwner, postHandler.DeletePost))).Methods("DELETE")
 	r.HandleFunc("/api/user/{USER_LOGIN}", postHandler.GetPostsOfUser).Methods("GET")
+	r.HandleFunc("/api/search", postHandler.Search).Methods("GET")
+
+	healthHandler := &health.Handler{
+		Checks:   st.checks,
+		Timeout:  cfg.HTTP.ReadyTimeout,
+		Draining: draining,
+		Logger:   logger,
+	}
+	r.HandleFunc("/healthz", healthHandler.Live).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Ready).Methods("GET")
+	r.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{})).Methods("GET")
 
 	r.HandleFunc("/api/login", userHandler.Re).Methods("POST")
 	r.HandleFunc("/api/register", userHandler.RegisterPage).Methods("POST")
+	r.HandleFunc("/api/token/refresh", userHandler.Refresh).Methods("POST")
+	r.Handle("/api/logout", middleware.RequireAuth(http.HandlerFunc(userHandler.Logout))).Methods("POST")
+	r.Handle("/api/logout/all", middleware.RequireAuth(http.HandlerFunc(userHandler.LogoutAll))).Methods("POST")
+	r.Handle("/api/sessions", middleware.RequireAuth(http.HandlerFunc(userHandler.ListSessions))).Methods("GET")
+	r.Handle("/api/sessions/{SESSION_ID}", middleware.RequireAuth(http.HandlerFunc(userHandler.RevokeSession))).Methods("DELETE")
 
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
-	r.Handle("/", http.FileServer(http.Dir("./static/html/")))
+	htmlDir := filepath.Join(cfg.StaticDir, "html")
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(cfg.StaticDir))))
+	r.Handle("/", http.FileServer(http.Dir(htmlDir)))
 
+	r.MethodNotAllowedHandler = http.HandlerFunc(apierror.MethodNotAllowed)
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		file, errReadFile := ioutil.ReadFile("./static/html/index.html")
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			apierror.NotFound(w, r)
+			return
+		}
+		file, errReadFile := ioutil.ReadFile(filepath.Join(htmlDir, "index.html"))
 		if errReadFile != nil {
 			log.Println(errReadFile)
 			return
@@ -109,14 +163,16 @@ func main() {
 		}
 	})
 
-	mux0 := middleware.Auth(r)
-	mux0 = middleware.AccessLog(logger, mux0)
-	mux0 = middleware.Panic(mux0)
+	return withMiddleware(r, []byte(cfg.Auth.Secret), sessRepo, logger, trustedProxies, appMetrics), nil
+}
 
-	fmt.Println("starting server at :8080")
-	errListen := http.ListenAndServe(":8080", mux0)
-	if errListen != nil {
-		log.Println("err in listen and serve", errListen)
-		return
-	}
+// withMiddleware wraps the routes. Panics are recovered inside the access
+// log, so a request that panicked is still logged with its id.
+func withMiddleware(r *mux.Router, secret []byte, sessions session.SessRepo, logger *zap.SugaredLogger,
+	trustedProxies []*net.IPNet, appMetrics *metrics.Metrics) http.Handler {
+	mux0 := middleware.Auth(secret, sessions, r)
+	mux0 = middleware.Panic(mux0)
+	mux0 = middleware.AccessLog(logger, trustedProxies, mux0)
+	mux0 = middleware.Metrics(appMetrics, r, mux0)
+	return mux0
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/config"
+	"redditclone/pkg/metrics"
+	"redditclone/pkg/middleware"
+	"redditclone/pkg/session"
+	"sync"
+	"testing"
+)
+
+// newMemoryServer runs the whole API with -storage=memory.
+func newMemoryServer(t *testing.T) *httptest.Server {
+	cfg := config.Default()
+	cfg.Storage = config.StorageMemory
+	cfg.StaticDir = t.TempDir()
+	cfg.Auth.Secret = "long enough secret"
+	require.NoError(t, cfg.Validate())
+
+	var closers []func(ctx context.Context) error
+	st, err := openStores(cfg, zap.NewNop().Sugar(), func(name string, close func(ctx context.Context) error) {
+		closers = append(closers, close)
+	})
+	require.NoError(t, err)
+	h, err := newHandler(cfg, st, zap.NewNop().Sugar(), prometheus.NewRegistry(), nil)
+	require.NoError(t, err)
+	ts := httptest.NewServer(h)
+	t.Cleanup(func() {
+		ts.Close()
+		for _, close := range closers {
+			assert.NoError(t, close(context.Background()))
+		}
+	})
+	return ts
+}
+
+// call sends body as JSON with the token and decodes the answer into res
+// unless it is nil.
+func call(t *testing.T, ts *httptest.Server, method, path, token string, body, res interface{}) int {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(data))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if res != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(res), "%s %s", method, path)
+	}
+	return resp.StatusCode
+}
+
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type postResp struct {
+	ID       string `json:"id"`
+	Score    int    `json:"score"`
+	Comments []struct {
+		Body string `json:"body"`
+	} `json:"comments"`
+}
+
+func TestMemoryStorage(t *testing.T) {
+	ts := newMemoryServer(t)
+	creds := map[string]string{"username": "athin", "password": "asdfghjk"}
+
+	assert.Equal(t, http.StatusOK, call(t, ts, "GET", "/readyz", "", nil, nil))
+
+	var reg tokens
+	require.Equal(t, http.StatusOK, call(t, ts, "POST", "/api/register", "", creds, &reg))
+	assert.NotEmpty(t, reg.Token)
+	assert.Equal(t, http.StatusUnprocessableEntity, call(t, ts, "POST", "/api/register", "", creds, nil))
+
+	var created postResp
+	status := call(t, ts, "POST", "/api/posts", reg.Token, map[string]string{
+		"category": "music", "type": "text", "title": "hello world", "text": "first post",
+	}, &created)
+	require.Equal(t, http.StatusCreated, status)
+	require.NotEmpty(t, created.ID)
+
+	var commented postResp
+	status = call(t, ts, "POST", "/api/post/"+created.ID, reg.Token, map[string]string{"comment": "nice"}, &commented)
+	assert.True(t, status < 300, "comment status %d", status)
+	require.Len(t, commented.Comments, 1)
+	assert.Equal(t, "nice", commented.Comments[0].Body)
+
+	// the author upvotes the new post
+	var voted postResp
+	assert.Equal(t, http.StatusOK, call(t, ts, "GET", "/api/post/"+created.ID+"/downvote", reg.Token, nil, &voted))
+	assert.Equal(t, -1, voted.Score)
+
+	var all, found []postResp
+	assert.Equal(t, http.StatusOK, call(t, ts, "GET", "/api/posts/", "", nil, &all))
+	assert.Len(t, all, 1)
+	assert.Equal(t, http.StatusOK, call(t, ts, "GET", "/api/search?q=hello", "", nil, &found))
+	assert.Len(t, found, 1)
+
+	// a second session from the login, then refresh and log out everywhere
+	var login tokens
+	require.Equal(t, http.StatusOK, call(t, ts, "POST", "/api/login", "", creds, &login))
+	var list struct {
+		Sessions []struct {
+			ID string `json:"id"`
+		} `json:"sessions"`
+	}
+	assert.Equal(t, http.StatusOK, call(t, ts, "GET", "/api/sessions", login.Token, nil, &list))
+	assert.Len(t, list.Sessions, 2)
+
+	var refreshed tokens
+	refresh := map[string]string{"refresh_token": login.RefreshToken}
+	require.Equal(t, http.StatusOK, call(t, ts, "POST", "/api/token/refresh", "", refresh, &refreshed))
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, call(t, ts, "POST", "/api/token/refresh", "", refresh, nil))
+
+	assert.Equal(t, http.StatusOK, call(t, ts, "POST", "/api/logout/all", reg.Token, nil, nil))
+	assert.Equal(t, http.StatusUnauthorized, call(t, ts, "GET", "/api/sessions", reg.Token, nil, nil))
+}
+
+func TestMemoryStorageConcurrent(t *testing.T) {
+	ts := newMemoryServer(t)
+	var author tokens
+	creds := map[string]string{"username": "author", "password": "asdfghjk"}
+	require.Equal(t, http.StatusOK, call(t, ts, "POST", "/api/register", "", creds, &author))
+	var created postResp
+	require.Equal(t, http.StatusCreated, call(t, ts, "POST", "/api/posts", author.Token, map[string]string{
+		"category": "news", "type": "link", "title": "hello", "url": "https://example.com",
+	}, &created))
+
+	// call stops the test with require, which only works on the test
+	// goroutine, the voters report through errs
+	const voters = 10
+	errs := make(chan string, voters)
+	var wg sync.WaitGroup
+	for i := 0; i < voters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]string{"username": fmt.Sprintf("voter%d", i), "password": "asdfghjk"})
+			resp, err := ts.Client().Post(ts.URL+"/api/register", "application/json", bytes.NewReader(body))
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			var tok tokens
+			err = json.NewDecoder(resp.Body).Decode(&tok)
+			resp.Body.Close()
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			req, _ := http.NewRequest("GET", ts.URL+"/api/post/"+created.ID+"/upvote", nil)
+			req.Header.Set("Authorization", "Bearer "+tok.Token)
+			resp, err = ts.Client().Do(req)
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				errs <- fmt.Sprintf("voter%d: upvote status %d", i, resp.StatusCode)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var got postResp
+	assert.Equal(t, http.StatusOK, call(t, ts, "GET", "/api/post/"+created.ID, "", nil, &got))
+	assert.Equal(t, voters+1, got.Score)
+}
+
+func TestPanicIsLogged(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	r := mux.NewRouter()
+	r.HandleFunc("/api/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h := withMiddleware(r, []byte("long enough secret"), session.NewMemorySessions(), zap.New(core).Sugar(),
+		nil, metrics.New(prometheus.NewRegistry()))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/boom", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	id := w.Header().Get(middleware.RequestIDHeader)
+	require.NotEmpty(t, id)
+
+	entries := logs.FilterMessage("New request").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, id, fields["request_id"])
+	assert.Equal(t, int64(http.StatusInternalServerError), fields["status"])
+}
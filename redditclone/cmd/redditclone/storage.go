@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.uber.org/zap"
+	"log"
+	"redditclone/pkg/config"
+	"redditclone/pkg/health"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/post"
+	"redditclone/pkg/repo"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+// stores are the repos behind the handlers and the readiness checks of the
+// backends they live in.
+type stores struct {
+	users    user.UserRepo
+	posts    post.PostDataFunctional
+	ids      idgen.Generator
+	sessions session.SessRepo
+	checks   []health.Check
+}
+
+// onShutdown registers what is released once the requests are drained, in
+// the order of the calls, see server.Server.OnShutdown.
+type onShutdown func(name string, close func(ctx context.Context) error)
+
+// openStores opens the storage chosen in the config.
+func openStores(cfg *config.Config, logger *zap.SugaredLogger, release onShutdown) (*stores, error) {
+	if cfg.Storage == config.StorageMemory {
+		return openMemory(cfg, logger, release)
+	}
+	return openDatabases(cfg, logger, release)
+}
+
+// openMemory keeps everything in the process, nothing survives a restart.
+func openMemory(cfg *config.Config, logger *zap.SugaredLogger, release onShutdown) (*stores, error) {
+	ids, err := newPostIDs(cfg.Posts.IDs, cfg.Posts.SnowflakeNode, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	sessions := session.NewMemorySessions()
+	sessions.Timeouts = session.Timeouts{MaxAge: cfg.Sessions.MaxAge, IdleTimeout: cfg.Sessions.IdleTimeout}
+	janitor := &session.Janitor{
+		Repo:     sessions,
+		Interval: cfg.Sessions.CleanupInterval,
+		Batch:    cfg.Sessions.CleanupBatch,
+		Logger:   logger,
+	}
+	janitor.Start()
+	release("session janitor", janitor.Stop)
+
+	return &stores{
+		users:    user.NewMemoryRepo(),
+		posts:    repo.NewPostMemoryRepo(),
+		ids:      ids,
+		sessions: sessions,
+	}, nil
+}
+
+// openDatabases connects to MySQL, Mongo and Redis when the sessions are kept
+// there, and brings their schemas up to date.
+func openDatabases(cfg *config.Config, logger *zap.SugaredLogger, release onShutdown) (*stores, error) {
+	db, err := sql.Open("mysql", cfg.MySQL.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MySQL.MaxOpenConns)
+	err = db.Ping() // проверяем подключение
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Connected to MySQL!")
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(cfg.Mongo.URI))
+	if err != nil {
+		return nil, err
+	}
+	err = client.Connect(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	err = client.Ping(context.TODO(), nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Connected to MongoDB!")
+	mongoDB := client.Database(cfg.Mongo.Database)
+
+	st := &stores{
+		users: user.NewMysqlRepo(db),
+		checks: []health.Check{
+			{Name: "mysql", Critical: true, Ping: db.PingContext},
+			{Name: "mongo", Critical: true, Ping: func(ctx context.Context) error {
+				return client.Ping(ctx, readpref.Primary())
+			}},
+		},
+	}
+
+	timeouts := session.Timeouts{MaxAge: cfg.Sessions.MaxAge, IdleTimeout: cfg.Sessions.IdleTimeout}
+	switch cfg.Sessions.Store {
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+		err = rdb.Ping(context.TODO()).Err()
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Connected to Redis!")
+		redisSessions := session.NewRedisSessions(rdb)
+		redisSessions.Timeouts = timeouts
+		st.sessions = redisSessions
+		st.checks = append(st.checks, health.Check{Name: "redis", Critical: true, Ping: func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		}})
+		release("redis", func(ctx context.Context) error {
+			return rdb.Close()
+		})
+	default:
+		mysqlSessions := session.NewSessionsRepo(db)
+		mysqlSessions.Timeouts = timeouts
+		err = mysqlSessions.Migrate(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		janitor := &session.Janitor{
+			Repo:     mysqlSessions,
+			Interval: cfg.Sessions.CleanupInterval,
+			Batch:    cfg.Sessions.CleanupBatch,
+			Logger:   logger,
+		}
+		janitor.Start()
+		st.sessions = mysqlSessions
+		release("session janitor", janitor.Stop)
+	}
+	release("mongo", client.Disconnect)
+	release("mysql", func(ctx context.Context) error {
+		return db.Close()
+	})
+
+	postRepo := repo.NewMongoRepo(mongoDB.Collection("posts"))
+	lastID, err := postRepo.LastID(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	st.ids, err = newPostIDs(cfg.Posts.IDs, cfg.Posts.SnowflakeNode, mongoDB.Collection("counters"), lastID)
+	if err != nil {
+		return nil, err
+	}
+	// the unique index of post ids is only built once no ids are shared
+	deduped, err := postRepo.DedupeIDs(context.TODO(), st.ids)
+	if err != nil {
+		return nil, err
+	}
+	if deduped > 0 {
+		log.Println("Gave new ids to", deduped, "posts with duplicate ids")
+	}
+	err = postRepo.EnsureIndexes(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	err = postRepo.Migrate(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	st.posts = postRepo
+	return st, nil
+}
+
+// newPostIDs makes the post id generator of the given kind. The counter
+// starts after the highest numeric id stored so far, without a counters
+// collection it only counts in this process.
+func newPostIDs(kind string, node int64, counters *mongo.Collection, last int64) (idgen.Generator, error) {
+	switch kind {
+	case "objectid":
+		return idgen.ObjectID{}, nil
+	case "snowflake":
+		return idgen.NewSnowflake(node)
+	case "counter":
+		if counters == nil {
+			return idgen.NewSequence(last), nil
+		}
+		c := idgen.NewCounter(counters, "posts")
+		return c, c.Ensure(context.TODO(), last)
+	}
+	return nil, fmt.Errorf("unknown post id generator %q", kind)
+}
@@ -0,0 +1,157 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/logging"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/repo"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
+)
+
+// Code tells clients what went wrong without parsing the message.
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeBadJSON          Code = "bad_json"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeBadCredentials   Code = "bad_credentials"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodePostNotFound     Code = "post_not_found"
+	CodeCommentNotFound  Code = "comment_not_found"
+	CodeUserNotFound     Code = "user_not_found"
+	CodeSessionNotFound  Code = "session_not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeValidation       Code = "validation_failed"
+	CodeInternal         Code = "internal"
+	CodeUnavailable      Code = "unavailable"
+)
+
+// FieldError is one invalid field of a request, the frontend shows them as
+// "<param> <msg>".
+type FieldError struct {
+	Location string `json:"location"`
+	Param    string `json:"param"`
+	Msg      string `json:"msg"`
+	Value    string `json:"value,omitempty"`
+}
+
+// Error is the body of every error response of the API. The cause is only
+// logged, clients see the code and the message.
+type Error struct {
+	Status  int          `json:"status"`
+	Code    Code         `json:"code"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+	cause   error
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func New(status int, code Code, msg string) *Error {
+	return &Error{Status: status, Code: code, Message: msg}
+}
+
+// Wrap keeps err as the cause of the response error.
+func Wrap(err error, status int, code Code, msg string) *Error {
+	return &Error{Status: status, Code: code, Message: msg, cause: err}
+}
+
+// Validation answers 422 with the invalid fields.
+func Validation(fields ...FieldError) *Error {
+	return &Error{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeValidation,
+		Message: "validation failed",
+		Errors:  fields,
+	}
+}
+
+var known = []struct {
+	err    error
+	status int
+	code   Code
+}{
+	{repo.ErrNoPost, http.StatusNotFound, CodePostNotFound},
+	{comment.ErrNoComment, http.StatusNotFound, CodeCommentNotFound},
+	{user.ErrNoUser, http.StatusNotFound, CodeUserNotFound},
+	{session.ErrNoSession, http.StatusNotFound, CodeSessionNotFound},
+	{mongo.ErrNoDocuments, http.StatusNotFound, CodeNotFound},
+	{repo.ErrNotAuthor, http.StatusForbidden, CodeForbidden},
+	{comment.ErrNotAuthor, http.StatusForbidden, CodeForbidden},
+	{user.ErrBadPass, http.StatusUnauthorized, CodeBadCredentials},
+	{session.ErrNoAuth, http.StatusUnauthorized, CodeUnauthorized},
+	{session.ErrRefreshReused, http.StatusUnauthorized, CodeUnauthorized},
+	{repo.ErrBadPostType, http.StatusUnprocessableEntity, CodeValidation},
+	{repo.ErrBadCursor, http.StatusBadRequest, CodeBadRequest},
+	{repo.ErrEmptyQuery, http.StatusBadRequest, CodeBadRequest},
+	{comment.ErrBadCursor, http.StatusBadRequest, CodeBadRequest},
+	{ranking.ErrBadSort, http.StatusBadRequest, CodeBadRequest},
+	{ranking.ErrBadPeriod, http.StatusBadRequest, CodeBadRequest},
+	{vote.ErrBadVote, http.StatusBadRequest, CodeBadRequest},
+	{repo.ErrDuplicateID, http.StatusConflict, CodeConflict},
+	{repo.ErrVoteConflict, http.StatusConflict, CodeConflict},
+	{repo.ErrCommentConflict, http.StatusConflict, CodeConflict},
+	{user.ErrUserExists, http.StatusConflict, CodeConflict},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable, CodeUnavailable},
+}
+
+// From turns err into a response error. The errors of the repositories get
+// their 4xx status, anything unknown is a 500 that does not leak the cause.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, k := range known {
+		if errors.Is(err, k.err) {
+			return Wrap(err, k.status, k.code, k.err.Error())
+		}
+	}
+	return Wrap(err, http.StatusInternalServerError, CodeInternal, "internal error")
+}
+
+// Write sends err as the JSON envelope. Server errors are logged with the
+// request logger together with their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) *Error {
+	apiErr := From(err)
+	logger := logging.FromContext(r.Context(), zap.S())
+	if apiErr.Status >= http.StatusInternalServerError {
+		logger.Errorw("request failed", "status", apiErr.Status, "code", apiErr.Code, "err", err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	if errEnc := json.NewEncoder(w).Encode(apiErr); errEnc != nil {
+		logger.Infow("Error of write", "err", errEnc)
+	}
+	return apiErr
+}
+
+// NotFound and MethodNotAllowed are for the router.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusNotFound, CodeNotFound, "not found"))
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
+}
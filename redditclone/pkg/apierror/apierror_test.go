@@ -0,0 +1,60 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/repo"
+	"redditclone/pkg/user"
+	"testing"
+)
+
+func TestFrom(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   Code
+	}{
+		{repo.ErrNoPost, 404, CodePostNotFound},
+		{fmt.Errorf("get: %w", repo.ErrNoPost), 404, CodePostNotFound},
+		{comment.ErrNoComment, 404, CodeCommentNotFound},
+		{user.ErrNoUser, 404, CodeUserNotFound},
+		{mongo.ErrNoDocuments, 404, CodeNotFound},
+		{repo.ErrNotAuthor, 403, CodeForbidden},
+		{repo.ErrBadCursor, 400, CodeBadRequest},
+		{repo.ErrDuplicateID, 409, CodeConflict},
+		{repo.ErrVoteConflict, 409, CodeConflict},
+		{repo.ErrCommentConflict, 409, CodeConflict},
+		{New(418, "teapot", "short and stout"), 418, "teapot"},
+		{errors.New("connection refused"), 500, CodeInternal},
+	}
+	for _, c := range cases {
+		res := From(c.err)
+		assert.Equal(t, c.status, res.Status, c.err.Error())
+		assert.Equal(t, c.code, res.Code, c.err.Error())
+	}
+	assert.Equal(t, "internal error", From(errors.New("password=secret")).Message, "causes of 500 are not sent")
+	assert.ErrorIs(t, From(repo.ErrNoPost), repo.ErrNoPost)
+}
+
+func TestWrite(t *testing.T) {
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("POST", "/api/register", nil), Validation(
+		FieldError{Location: "body", Param: "username", Msg: "already exists", Value: "arin0"},
+	))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "validation_failed", body["code"])
+	assert.Equal(t, "validation failed", body["message"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"location": "body", "param": "username", "msg": "already exists", "value": "arin0",
+	}}, body["errors"])
+}
@@ -1,19 +1,48 @@
 package comment
 
 import (
+	"encoding/json"
 	"redditclone/pkg/user"
 )
 
 type Comment struct {
-	Author  user.User `json:"author" bson:"author"`
-	Body    string    `json:"body" bson:"body"`
-	Created string    `json:"created" bson:"created"`
-	ID      int64     `json:"id" bson:"id"`
+	Author   user.User  `json:"author" bson:"author"`
+	Body     string     `json:"body" bson:"body"`
+	Created  string     `json:"created" bson:"created"`
+	ID       int64      `json:"id" bson:"id"`
+	ParentID *int64     `json:"parentID,omitempty" bson:"parentID,omitempty"`
+	Deleted  bool       `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	Edited   string     `json:"edited,omitempty" bson:"edited,omitempty"`
+	History  []Revision `json:"history,omitempty" bson:"history,omitempty"`
+}
+
+// commentJSON is a Comment without its MarshalJSON.
+type commentJSON Comment
+
+// shown is the comment as the clients see it. The body of a deleted comment
+// is kept empty so the search of no storage finds it, the clients get
+// DeletedBody instead.
+func (item Comment) shown() commentJSON {
+	if item.Deleted {
+		item.Body = DeletedBody
+	}
+	return commentJSON(item)
+}
+
+func (item Comment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(item.shown())
+}
+
+// Revision is an earlier text of an edited comment.
+type Revision struct {
+	Body    string `json:"body" bson:"body"`
+	Created string `json:"created" bson:"created"`
 }
 
 type CommentRepo interface {
 	GetAll() []*Comment
 	Get(id int64) (*Comment, error)
 	Create(text string, author *user.User) (*Comment, error)
+	Edit(id int64, text string, author *user.User) (*Comment, error)
 	Delete(id int64) []*Comment
 }
@@ -9,11 +9,16 @@ import (
 
 var (
 	ErrNoComment = errors.New("no comment found")
+	ErrNotAuthor = errors.New("comment belongs to another user")
 )
 
+// DeletedBody is shown in place of the text of a deleted comment that still
+// has replies, the text itself is cleared.
+const DeletedBody = "[deleted]"
+
 type CommentMemoryRepo struct {
-	lastIndex int        `json:"last_index" bson:"lastIndex"`
-	data      []*Comment `bson:"data" json:"data"`
+	lastIndex int
+	data      []*Comment
 	mutex     sync.Mutex
 }
 
@@ -50,25 +55,191 @@ func (c *CommentMemoryRepo) Create(text string, author *user.User) (*Comment, er
 	return item, nil
 }
 
+func (c *CommentMemoryRepo) Edit(id int64, text string, author *user.User) (*Comment, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, item := range c.data {
+		if item.ID == id {
+			return item, item.edit(text, author)
+		}
+	}
+	return nil, ErrNoComment
+}
+
+// New makes a comment without an ID, the storage assigns it.
+func New(text string, author *user.User) *Comment {
+	return &Comment{
+		Author:  *author,
+		Body:    text,
+		Created: time.Now().Format(time.RFC3339),
+	}
+}
+
 func Create(c []Comment, text string, author *user.User) ([]Comment, error) {
-	item := new(Comment)
-	item.ID = int64(len(c))
-	item.Author = *author
-	item.Created = time.Now().Format(time.RFC3339)
-	item.Body = text
+	item := New(text, author)
+	for _, old := range c {
+		if old.ID >= item.ID {
+			item.ID = old.ID + 1
+		}
+	}
 	c = append(c, *item)
 	return c, nil
 }
+
+// CanReply tells whether the comment parentID can be answered: it exists and
+// is not deleted.
+func CanReply(c []Comment, parentID int64) bool {
+	k := find(c, parentID)
+	return k >= 0 && !c[k].Deleted
+}
+
+// Reply adds an answer to the comment parentID. Replies to missing or deleted
+// comments are rejected.
+func Reply(c []Comment, parentID int64, text string, author *user.User) ([]Comment, error) {
+	if !CanReply(c, parentID) {
+		return nil, ErrNoComment
+	}
+	c, err := Create(c, text, author)
+	if err != nil {
+		return nil, err
+	}
+	c[len(c)-1].ParentID = &parentID
+	return c, nil
+}
+
+// Edit changes the text of the comment id. Only its author can do it, the
+// previous text is kept in the comment history.
+func Edit(c []Comment, id int64, text string, author *user.User) ([]Comment, error) {
+	k := find(c, id)
+	if k < 0 {
+		return nil, ErrNoComment
+	}
+	if err := c[k].edit(text, author); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Editable finds the comment id when author may edit it: it is not deleted
+// and author wrote it.
+func Editable(c []Comment, id int64, author *user.User) (*Comment, error) {
+	k := find(c, id)
+	if k < 0 {
+		return nil, ErrNoComment
+	}
+	if err := c[k].editableBy(author); err != nil {
+		return nil, err
+	}
+	return &c[k], nil
+}
+
+func (item *Comment) editableBy(author *user.User) error {
+	if item.Deleted {
+		return ErrNoComment
+	}
+	if item.Author.Login != author.Login {
+		return ErrNotAuthor
+	}
+	return nil
+}
+
+func (item *Comment) edit(text string, author *user.User) error {
+	if err := item.editableBy(author); err != nil {
+		return err
+	}
+	item.History = append(item.History, item.Revision())
+	item.Body = text
+	item.Edited = time.Now().Format(time.RFC3339)
+	return nil
+}
+
+// Revision is the current text of the comment as it goes to the history
+// when the comment is edited.
+func (item *Comment) Revision() Revision {
+	created := item.Created
+	if item.Edited != "" {
+		created = item.Edited
+	}
+	return Revision{Body: item.Body, Created: created}
+}
+
+// Delete removes the comment id. A comment that still has replies is only
+// tombstoned so the thread below it stays reachable; tombstones left without
+// replies are removed together with their last reply.
 func Delete(c []Comment, id int64) []Comment {
-	var k int
+	k := find(c, id)
+	if k < 0 {
+		return c
+	}
+	if hasReplies(c, id) {
+		c[k].Body = ""
+		c[k].Author = user.User{}
+		c[k].History = nil
+		c[k].Deleted = true
+		return c
+	}
+	parent := c[k].ParentID
+	c = append(c[:k], c[k+1:]...)
+	if parent == nil {
+		return c
+	}
+	if p := find(c, *parent); p >= 0 && c[p].Deleted && !hasReplies(c, *parent) {
+		return Delete(c, *parent)
+	}
+	return c
+}
+
+// Deletion is what deleting a comment takes: either the comment is
+// tombstoned or the comments in Remove are removed.
+type Deletion struct {
+	Tombstone bool
+	Remove    []int64
+}
+
+// PlanDelete tells what Delete does with the comment id without changing c,
+// so a storage can apply it with its own atomic operations. It returns false
+// when there is no such comment.
+func PlanDelete(c []Comment, id int64) (Deletion, bool) {
+	k := find(c, id)
+	if k < 0 {
+		return Deletion{}, false
+	}
+	if hasReplies(c, id) {
+		return Deletion{Tombstone: true}, true
+	}
+	d := Deletion{Remove: []int64{id}}
+	for parent := c[k].ParentID; parent != nil; {
+		p := find(c, *parent)
+		if p < 0 || !c[p].Deleted || countReplies(c, *parent) > 1 {
+			break
+		}
+		d.Remove = append(d.Remove, *parent)
+		parent = c[p].ParentID
+	}
+	return d, true
+}
+
+func find(c []Comment, id int64) int {
 	for i, item := range c {
 		if item.ID == id {
-			k = i
-			break
+			return i
 		}
 	}
-	c = append(c[:k], c[k+1:]...)
-	return c
+	return -1
+}
+
+func hasReplies(c []Comment, id int64) bool {
+	return countReplies(c, id) > 0
+}
+
+func countReplies(c []Comment, id int64) int {
+	n := 0
+	for _, item := range c {
+		if item.ParentID != nil && *item.ParentID == id {
+			n++
+		}
+	}
+	return n
 }
 
 /*
@@ -0,0 +1,182 @@
+package comment
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/user"
+	"testing"
+)
+
+var author = &user.User{ID: 3, Login: "arin0"}
+
+func makeThread(t *testing.T) []Comment {
+	c, err := Create([]Comment{}, "root", author)
+	assert.NoError(t, err)
+	c, err = Reply(c, 0, "first reply", author)
+	assert.NoError(t, err)
+	c, err = Reply(c, 1, "reply to reply", author)
+	assert.NoError(t, err)
+	c, err = Reply(c, 0, "second reply", author)
+	assert.NoError(t, err)
+	return c
+}
+
+func TestReply(t *testing.T) {
+	c := makeThread(t)
+	assert.Len(t, c, 4)
+	assert.Nil(t, c[0].ParentID)
+	assert.Equal(t, int64(0), *c[1].ParentID)
+	assert.Equal(t, int64(1), *c[2].ParentID)
+
+	_, err := Reply(c, 42, "nowhere", author)
+	assert.Equal(t, ErrNoComment, err)
+}
+
+func TestDeleteTombstone(t *testing.T) {
+	c := makeThread(t)
+
+	c = Delete(c, 1)
+	assert.Len(t, c, 4)
+	assert.True(t, c[1].Deleted)
+	assert.Empty(t, c[1].Body)
+	assert.Equal(t, user.User{}, c[1].Author)
+
+	// the clients see the placeholder, alone and in a thread with its replies
+	data, err := json.Marshal(c[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"body":"`+DeletedBody+`"`)
+	threads, _ := BuildTree(c, Cursor{Parent: 0, After: Root}, DefaultDepth, DefaultLimit)
+	data, err = json.Marshal(threads)
+	assert.NoError(t, err)
+	var shown []struct {
+		Body    string `json:"body"`
+		Deleted bool   `json:"deleted"`
+		Replies []struct {
+			Body string `json:"body"`
+		} `json:"replies"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &shown))
+	assert.Equal(t, DeletedBody, shown[0].Body)
+	assert.True(t, shown[0].Deleted)
+	assert.Equal(t, c[2].Body, shown[0].Replies[0].Body)
+
+	_, err = Reply(c, 1, "to deleted", author)
+	assert.Equal(t, ErrNoComment, err)
+
+	// the last reply of a tombstone takes the tombstone with it
+	c = Delete(c, 2)
+	assert.Len(t, c, 2)
+	assert.Equal(t, int64(0), c[0].ID)
+	assert.Equal(t, int64(3), c[1].ID)
+
+	c = Delete(c, 42)
+	assert.Len(t, c, 2)
+}
+
+func TestPlanDelete(t *testing.T) {
+	c := makeThread(t)
+
+	d, ok := PlanDelete(c, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Deletion{Tombstone: true}, d)
+
+	c = Delete(c, 1)
+	d, ok = PlanDelete(c, 2)
+	assert.True(t, ok)
+	assert.Equal(t, Deletion{Remove: []int64{2, 1}}, d)
+
+	d, ok = PlanDelete(c, 3)
+	assert.True(t, ok)
+	assert.Equal(t, Deletion{Remove: []int64{3}}, d)
+
+	_, ok = PlanDelete(c, 42)
+	assert.False(t, ok)
+
+	// IDs are not taken from the length so they do not collide after deletes
+	gap, err := Create([]Comment{{ID: 5}}, "new", author)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), gap[1].ID)
+	assert.True(t, CanReply(c, 0))
+	assert.False(t, CanReply(c, 1))
+}
+
+func TestBuildTree(t *testing.T) {
+	c := makeThread(t)
+
+	threads, next := BuildTree(c, Cursor{Parent: Root, After: Root}, DefaultDepth, DefaultLimit)
+	assert.Empty(t, next)
+	assert.Len(t, threads, 1)
+	assert.Len(t, threads[0].Replies, 2)
+	assert.Equal(t, "reply to reply", threads[0].Replies[0].Replies[0].Body)
+
+	threads, _ = BuildTree(c, Cursor{Parent: Root, After: Root}, 2, DefaultLimit)
+	deep := threads[0].Replies[0]
+	assert.Empty(t, deep.Replies)
+	assert.Equal(t, 1, deep.MoreReplies)
+	assert.Equal(t, "1:-1", deep.Cursor)
+
+	threads, _ = BuildTree(c, Cursor{Parent: Root, After: Root}, DefaultDepth, 1)
+	assert.Len(t, threads[0].Replies, 1)
+	assert.Equal(t, 1, threads[0].MoreReplies)
+
+	from, err := ParseCursor(threads[0].Cursor)
+	assert.NoError(t, err)
+	threads, next = BuildTree(c, from, DefaultDepth, 1)
+	assert.Empty(t, next)
+	assert.Len(t, threads, 1)
+	assert.Equal(t, "second reply", threads[0].Body)
+
+	_, err = ParseCursor("bad")
+	assert.Equal(t, ErrBadCursor, err)
+}
+
+func TestEdit(t *testing.T) {
+	c := makeThread(t)
+
+	c, err := Edit(c, 0, "root edited", author)
+	assert.NoError(t, err)
+	assert.Equal(t, "root edited", c[0].Body)
+	assert.NotEmpty(t, c[0].Edited)
+	assert.Equal(t, []Revision{{Body: "root", Created: c[0].Created}}, c[0].History)
+
+	c, err = Edit(c, 0, "root edited twice", author)
+	assert.NoError(t, err)
+	assert.Len(t, c[0].History, 2)
+	assert.Equal(t, "root edited", c[0].History[1].Body)
+	assert.Equal(t, Revision{Body: "root edited twice", Created: c[0].Edited}, c[0].Revision())
+
+	item, err := Editable(c, 0, author)
+	assert.NoError(t, err)
+	assert.Equal(t, &c[0], item)
+	_, err = Editable(c, 0, &user.User{ID: 4, Login: "other"})
+	assert.Equal(t, ErrNotAuthor, err)
+
+	_, err = Edit(c, 0, "not mine", &user.User{ID: 4, Login: "other"})
+	assert.Equal(t, ErrNotAuthor, err)
+
+	_, err = Edit(c, 42, "nowhere", author)
+	assert.Equal(t, ErrNoComment, err)
+
+	c = Delete(c, 0)
+	assert.Nil(t, c[0].History)
+	_, err = Edit(c, 0, "deleted", author)
+	assert.Equal(t, ErrNoComment, err)
+	_, err = Editable(c, 0, author)
+	assert.Equal(t, ErrNoComment, err)
+}
+
+func TestMemoryRepoEdit(t *testing.T) {
+	repo := NewMemoryRepo()
+	item, err := repo.Create("text", author)
+	assert.NoError(t, err)
+
+	edited, err := repo.Edit(item.ID, "new text", author)
+	assert.NoError(t, err)
+	assert.Equal(t, "new text", edited.Body)
+	assert.Equal(t, "text", edited.History[0].Body)
+
+	_, err = repo.Edit(item.ID, "new text", &user.User{ID: 4, Login: "other"})
+	assert.Equal(t, ErrNotAuthor, err)
+	_, err = repo.Edit(42, "new text", author)
+	assert.Equal(t, ErrNoComment, err)
+}
@@ -0,0 +1,123 @@
+package comment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Root is the parent of top level comments in a Cursor.
+	Root int64 = -1
+
+	DefaultDepth = 5
+	MaxDepth     = 10
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var ErrBadCursor = errors.New("bad comment cursor")
+
+// Thread is a comment together with the replies loaded for it.
+// MoreReplies counts the replies that were cut off by the depth or limit,
+// Cursor loads them.
+type Thread struct {
+	Comment
+	Replies     []*Thread `json:"replies"`
+	MoreReplies int       `json:"moreReplies,omitempty"`
+	Cursor      string    `json:"cursor,omitempty"`
+}
+
+// MarshalJSON keeps the replies next to the comment, the MarshalJSON of the
+// embedded Comment alone would drop them.
+func (t Thread) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		commentJSON
+		Replies     []*Thread `json:"replies"`
+		MoreReplies int       `json:"moreReplies,omitempty"`
+		Cursor      string    `json:"cursor,omitempty"`
+	}{t.Comment.shown(), t.Replies, t.MoreReplies, t.Cursor})
+}
+
+// Cursor points to the replies of Parent that go after the comment After.
+type Cursor struct {
+	Parent int64
+	After  int64
+}
+
+func (c Cursor) String() string {
+	return fmt.Sprintf("%d:%d", c.Parent, c.After)
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	c := Cursor{}
+	_, err := fmt.Sscanf(s, "%d:%d", &c.Parent, &c.After)
+	if err != nil || c.Parent < Root || c.After < Root {
+		return Cursor{}, ErrBadCursor
+	}
+	return c, nil
+}
+
+// BuildTree turns the flat comment list of a post into threads starting at
+// the cursor position. At most limit replies are loaded per comment and at
+// most depth levels deep. The returned cursor continues the top level list
+// and is empty when everything was loaded.
+func BuildTree(c []Comment, from Cursor, depth, limit int) ([]*Thread, string) {
+	if depth < 1 {
+		depth = 1
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	children := make(map[int64][]Comment)
+	for _, item := range c {
+		parent := Root
+		if item.ParentID != nil {
+			parent = *item.ParentID
+		}
+		children[parent] = append(children[parent], item)
+	}
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+	threads, more := buildLevel(children, from, depth, limit)
+	if more == 0 {
+		return threads, ""
+	}
+	return threads, Cursor{Parent: from.Parent, After: threads[len(threads)-1].ID}.String()
+}
+
+func buildLevel(children map[int64][]Comment, from Cursor, depth, limit int) ([]*Thread, int) {
+	list := children[from.Parent]
+	start := 0
+	if from.After != Root {
+		for start < len(list) && list[start].ID <= from.After {
+			start++
+		}
+	}
+	list = list[start:]
+	more := 0
+	if len(list) > limit {
+		more = len(list) - limit
+		list = list[:limit]
+	}
+
+	threads := make([]*Thread, 0, len(list))
+	for _, item := range list {
+		t := &Thread{Comment: item, Replies: []*Thread{}}
+		if depth <= 1 {
+			t.MoreReplies = len(children[item.ID])
+			if t.MoreReplies > 0 {
+				t.Cursor = Cursor{Parent: item.ID, After: Root}.String()
+			}
+		} else {
+			t.Replies, t.MoreReplies = buildLevel(children, Cursor{Parent: item.ID, After: Root}, depth-1, limit)
+			if t.MoreReplies > 0 {
+				t.Cursor = Cursor{Parent: item.ID, After: t.Replies[len(t.Replies)-1].ID}.String()
+			}
+		}
+		threads = append(threads, t)
+	}
+	return threads, more
+}
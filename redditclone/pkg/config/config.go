@@ -0,0 +1,358 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pelletier/go-toml"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"redditclone/pkg/health"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/middleware"
+	"redditclone/pkg/server"
+	"redditclone/pkg/session"
+	"redditclone/pkg/views"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the names of the environment variables that override the
+// config file, REDDITCLONE_MYSQL_DSN overrides the mysql-dsn flag and so on.
+const EnvPrefix = "REDDITCLONE_"
+
+// MinSecretLen is the shortest JWT secret the server starts with.
+const MinSecretLen = 16
+
+var (
+	ErrBadFormat = errors.New("config file must be .yaml, .yml or .toml")
+)
+
+type HTTP struct {
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ReadyTimeout    time.Duration `yaml:"ready_timeout" toml:"ready_timeout"`
+	// DrainDelay is how long /readyz answers 503 on shutdown while the
+	// requests are still served, before the server stops accepting them.
+	DrainDelay time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+	// TrustedProxies are the CIDRs or IPs whose X-Forwarded-For is believed.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+type MySQL struct {
+	DSN          string `yaml:"dsn" toml:"dsn"`
+	MaxOpenConns int    `yaml:"max_open_conns" toml:"max_open_conns"`
+}
+
+type Mongo struct {
+	URI      string `yaml:"uri" toml:"uri"`
+	Database string `yaml:"database" toml:"database"`
+}
+
+type Auth struct {
+	Secret   string        `yaml:"secret" toml:"secret"`
+	TokenTTL time.Duration `yaml:"token_ttl" toml:"token_ttl"`
+}
+
+// Sessions are kept in Store, mysql or redis, unless the whole storage is in
+// memory. They end MaxAge after the login or IdleTimeout after the last
+// request, the expired ones are deleted every CleanupInterval and Redis drops
+// them by itself.
+type Sessions struct {
+	Store           string        `yaml:"store" toml:"store"`
+	MaxAge          time.Duration `yaml:"max_age" toml:"max_age"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+	CleanupBatch    int           `yaml:"cleanup_batch" toml:"cleanup_batch"`
+}
+
+type Redis struct {
+	Addr     string `yaml:"addr" toml:"addr"`
+	Password string `yaml:"password" toml:"password"`
+	DB       int    `yaml:"db" toml:"db"`
+}
+
+type Posts struct {
+	IDs           string        `yaml:"ids" toml:"ids"`
+	SnowflakeNode int64         `yaml:"snowflake_node" toml:"snowflake_node"`
+	ViewsWindow   time.Duration `yaml:"views_window" toml:"views_window"`
+}
+
+// Storage values: the posts in Mongo and the users and sessions in MySQL or
+// Redis, or everything in memory and lost on restart.
+const (
+	StorageDB     = "db"
+	StorageMemory = "memory"
+)
+
+// Config holds everything the server needs to start. The values come from
+// Default, then the config file, then the environment and then the command
+// line, each one overriding the previous.
+type Config struct {
+	Addr      string   `yaml:"addr" toml:"addr"`
+	Storage   string   `yaml:"storage" toml:"storage"`
+	StaticDir string   `yaml:"static_dir" toml:"static_dir"`
+	HTTP      HTTP     `yaml:"http" toml:"http"`
+	MySQL     MySQL    `yaml:"mysql" toml:"mysql"`
+	Mongo     Mongo    `yaml:"mongo" toml:"mongo"`
+	Redis     Redis    `yaml:"redis" toml:"redis"`
+	Auth      Auth     `yaml:"auth" toml:"auth"`
+	Sessions  Sessions `yaml:"sessions" toml:"sessions"`
+	Posts     Posts    `yaml:"posts" toml:"posts"`
+}
+
+// Default has no MySQL DSN and no secret, they always have to be configured.
+func Default() *Config {
+	return &Config{
+		Addr:      ":8080",
+		Storage:   StorageDB,
+		StaticDir: "./static/",
+		HTTP: HTTP{
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: server.DefaultShutdownTimeout,
+			ReadyTimeout:    health.DefaultTimeout,
+		},
+		MySQL: MySQL{MaxOpenConns: 10},
+		Mongo: Mongo{
+			URI:      "mongodb://127.0.0.1:27017",
+			Database: "coursera",
+		},
+		Redis: Redis{Addr: "127.0.0.1:6379"},
+		Auth:  Auth{TokenTTL: 20 * time.Minute},
+		Sessions: Sessions{
+			Store:           "mysql",
+			MaxAge:          session.DefaultMaxAge,
+			IdleTimeout:     session.DefaultIdleTimeout,
+			CleanupInterval: session.DefaultCleanupInterval,
+			CleanupBatch:    session.DefaultCleanupBatch,
+		},
+		Posts: Posts{IDs: "counter", ViewsWindow: views.DefaultWindow},
+	}
+}
+
+// listValue is a comma separated flag, setting it replaces the whole list.
+type listValue struct {
+	list *[]string
+}
+
+func (v listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v listValue) Set(value string) error {
+	*v.list = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.list = append(*v.list, item)
+		}
+	}
+	return nil
+}
+
+// bind registers the flags that set the fields of cfg.
+func bind(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address to listen on")
+	fs.StringVar(&cfg.Storage, "storage", cfg.Storage, "db, or memory to run without MySQL, Mongo and Redis")
+	fs.StringVar(&cfg.StaticDir, "static-dir", cfg.StaticDir, "directory with the frontend files")
+	fs.DurationVar(&cfg.HTTP.ReadTimeout, "read-timeout", cfg.HTTP.ReadTimeout, "max duration of reading a request")
+	fs.DurationVar(&cfg.HTTP.WriteTimeout, "write-timeout", cfg.HTTP.WriteTimeout, "max duration of writing a response")
+	fs.DurationVar(&cfg.HTTP.IdleTimeout, "idle-timeout", cfg.HTTP.IdleTimeout, "how long keep-alive connections wait for the next request")
+	fs.DurationVar(&cfg.HTTP.DrainDelay, "drain-delay", cfg.HTTP.DrainDelay, "how long the server reports not ready and keeps serving on shutdown")
+	fs.DurationVar(&cfg.HTTP.ShutdownTimeout, "shutdown-timeout", cfg.HTTP.ShutdownTimeout, "how long in-flight requests are waited for on shutdown")
+	fs.DurationVar(&cfg.HTTP.ReadyTimeout, "ready-timeout", cfg.HTTP.ReadyTimeout, "timeout of each dependency ping of /readyz")
+	fs.Var(listValue{&cfg.HTTP.TrustedProxies}, "trusted-proxies", "comma separated CIDRs of the proxies whose X-Forwarded-For is trusted")
+	fs.StringVar(&cfg.MySQL.DSN, "mysql-dsn", cfg.MySQL.DSN, "MySQL data source name")
+	fs.IntVar(&cfg.MySQL.MaxOpenConns, "mysql-max-open-conns", cfg.MySQL.MaxOpenConns, "max open connections to MySQL")
+	fs.StringVar(&cfg.Mongo.URI, "mongo-uri", cfg.Mongo.URI, "MongoDB connection string")
+	fs.StringVar(&cfg.Mongo.Database, "mongo-db", cfg.Mongo.Database, "MongoDB database with the posts")
+	fs.StringVar(&cfg.Redis.Addr, "redis-addr", cfg.Redis.Addr, "Redis host:port, used by the redis session store")
+	fs.StringVar(&cfg.Redis.Password, "redis-password", cfg.Redis.Password, "Redis password")
+	fs.IntVar(&cfg.Redis.DB, "redis-db", cfg.Redis.DB, "Redis database number")
+	fs.StringVar(&cfg.Auth.Secret, "jwt-secret", cfg.Auth.Secret, "secret that signs the auth tokens")
+	fs.DurationVar(&cfg.Auth.TokenTTL, "token-ttl", cfg.Auth.TokenTTL, "lifetime of an auth token")
+	fs.StringVar(&cfg.Sessions.Store, "session-store", cfg.Sessions.Store, "where the sessions are kept: mysql or redis")
+	fs.DurationVar(&cfg.Sessions.MaxAge, "session-max-age", cfg.Sessions.MaxAge, "sessions end this long after the login")
+	fs.DurationVar(&cfg.Sessions.IdleTimeout, "session-idle-timeout", cfg.Sessions.IdleTimeout, "sessions end this long after their last request")
+	fs.DurationVar(&cfg.Sessions.CleanupInterval, "session-cleanup-interval", cfg.Sessions.CleanupInterval, "how often expired sessions are deleted")
+	fs.IntVar(&cfg.Sessions.CleanupBatch, "session-cleanup-batch", cfg.Sessions.CleanupBatch, "expired sessions deleted per query")
+	fs.StringVar(&cfg.Posts.IDs, "post-ids", cfg.Posts.IDs, "post id generator: counter, objectid or snowflake")
+	fs.Int64Var(&cfg.Posts.SnowflakeNode, "snowflake-node", cfg.Posts.SnowflakeNode, "node number of this process for snowflake post ids")
+	fs.DurationVar(&cfg.Posts.ViewsWindow, "views-window", cfg.Posts.ViewsWindow, "repeated views of a post by the same user within the window are counted once")
+}
+
+// EnvName is the environment variable that overrides the flag name.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Load builds the config from the command line arguments and the environment
+// and validates it. The file is given by -config or REDDITCLONE_CONFIG, without
+// one only the defaults, the environment and the flags are used.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	// the flags are parsed first to find the config file, they are applied on
+	// top of it afterwards
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", "", "path to a .yaml or .toml config file, also "+EnvName("config"))
+	bind(fs, Default())
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	if *path == "" {
+		*path, _ = lookupEnv(EnvName("config"))
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.ReadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	apply := flag.NewFlagSet(name, flag.ContinueOnError)
+	bind(apply, cfg)
+	var err error
+	apply.VisitAll(func(f *flag.Flag) {
+		if value, ok := lookupEnv(EnvName(f.Name)); ok && err == nil {
+			if errSet := f.Value.Set(value); errSet != nil {
+				err = fmt.Errorf("%s: %w", EnvName(f.Name), errSet)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && err == nil {
+			err = apply.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ReadFile overrides cfg with the fields present in the file. Unknown fields
+// are an error so that a typo does not silently leave a default in place.
+func (cfg *Config) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if err == io.EOF {
+			err = nil
+		}
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).Strict(true).Decode(cfg)
+	default:
+		return ErrBadFormat
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports all the problems of the config at once.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	_, _, errAddr := net.SplitHostPort(cfg.Addr)
+	check(errAddr == nil, "addr %q: must be host:port", cfg.Addr)
+	info, errStatic := os.Stat(cfg.StaticDir)
+	check(errStatic == nil && info.IsDir(), "static dir %q: not a directory", cfg.StaticDir)
+	check(cfg.HTTP.ReadTimeout > 0 && cfg.HTTP.WriteTimeout > 0 && cfg.HTTP.IdleTimeout > 0,
+		"http timeouts must be positive")
+	check(cfg.HTTP.DrainDelay >= 0, "drain delay must not be negative")
+	check(cfg.HTTP.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check(cfg.HTTP.ReadyTimeout > 0, "ready timeout must be positive")
+	_, errProxies := middleware.ParseTrustedProxies(cfg.HTTP.TrustedProxies)
+	check(errProxies == nil, "%v", errProxies)
+
+	switch cfg.Storage {
+	case StorageDB:
+		cfg.validateDatabases(check)
+	case StorageMemory:
+	default:
+		check(false, "unknown storage %q", cfg.Storage)
+	}
+
+	check(len(cfg.Auth.Secret) >= MinSecretLen, "jwt secret must be at least %d bytes", MinSecretLen)
+	check(cfg.Auth.TokenTTL > 0, "token ttl must be positive")
+	check(cfg.Sessions.MaxAge > 0 && cfg.Sessions.IdleTimeout > 0, "session timeouts must be positive")
+	check(cfg.Sessions.CleanupInterval > 0, "session cleanup interval must be positive")
+	check(cfg.Sessions.CleanupBatch > 0, "session cleanup batch must be positive")
+
+	switch cfg.Posts.IDs {
+	case "counter", "objectid":
+	case "snowflake":
+		check(cfg.Posts.SnowflakeNode >= 0 && cfg.Posts.SnowflakeNode <= idgen.MaxNode,
+			"snowflake node must be in [0, %d]", idgen.MaxNode)
+	default:
+		check(false, "unknown post id generator %q", cfg.Posts.IDs)
+	}
+	check(cfg.Posts.ViewsWindow > 0, "views window must be positive")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("bad config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateDatabases checks the settings that are only used with StorageDB.
+func (cfg *Config) validateDatabases(check func(ok bool, format string, args ...interface{})) {
+	if cfg.MySQL.DSN == "" {
+		check(false, "mysql dsn is required")
+	} else {
+		_, errDSN := mysql.ParseDSN(cfg.MySQL.DSN)
+		check(errDSN == nil, "mysql dsn: %v", errDSN)
+	}
+	check(cfg.MySQL.MaxOpenConns > 0, "mysql max open conns must be positive")
+
+	if cfg.Mongo.URI == "" {
+		check(false, "mongo uri is required")
+	} else {
+		errURI := options.Client().ApplyURI(cfg.Mongo.URI).Validate()
+		check(errURI == nil, "mongo uri: %v", errURI)
+	}
+	check(cfg.Mongo.Database != "", "mongo database is required")
+
+	switch cfg.Sessions.Store {
+	case "mysql":
+	case "redis":
+		_, _, errRedis := net.SplitHostPort(cfg.Redis.Addr)
+		check(errRedis == nil, "redis addr %q: must be host:port", cfg.Redis.Addr)
+		check(cfg.Redis.DB >= 0, "redis db must not be negative")
+	default:
+		check(false, "unknown session store %q", cfg.Sessions.Store)
+	}
+}
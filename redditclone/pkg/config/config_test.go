@@ -0,0 +1,144 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDSN = "root:love@tcp(localhost:3306)/golang?charset=utf8&interpolateParams=true"
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	static := t.TempDir()
+	path := writeFile(t, "cfg.yaml", `
+addr: ":9000"
+static_dir: "`+static+`"
+mysql:
+  dsn: "`+testDSN+`"
+mongo:
+  database: staging
+auth:
+  secret: file secret of the server
+  token_ttl: 5m
+`)
+	cfg, err := Load("test", []string{"-config", path, "-mongo-db", "flagdb", "-trusted-proxies", "10.0.0.0/8, 127.0.0.1"}, env(map[string]string{
+		"REDDITCLONE_MONGO_DB":   "envdb",
+		"REDDITCLONE_JWT_SECRET": "env secret of the server",
+		"REDDITCLONE_ADDR":       ":9001",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, ":9001", cfg.Addr)
+	assert.Equal(t, "flagdb", cfg.Mongo.Database)
+	assert.Equal(t, "env secret of the server", cfg.Auth.Secret)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, testDSN, cfg.MySQL.DSN)
+	assert.Equal(t, []string{"10.0.0.0/8", "127.0.0.1"}, cfg.HTTP.TrustedProxies)
+	// not in the file, the environment or the flags
+	assert.Equal(t, Default().Mongo.URI, cfg.Mongo.URI)
+	assert.Equal(t, "counter", cfg.Posts.IDs)
+	assert.Equal(t, 7*24*time.Hour, cfg.Sessions.IdleTimeout)
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	path := writeFile(t, "cfg.toml", `
+static_dir = "`+t.TempDir()+`"
+
+[mysql]
+dsn = "`+testDSN+`"
+max_open_conns = 3
+
+[auth]
+secret = "toml secret of the server"
+
+[http]
+drain_delay = "5s"
+
+[posts]
+ids = "snowflake"
+snowflake_node = 7
+views_window = "1h"
+`)
+	cfg, err := Load("test", nil, env(map[string]string{"REDDITCLONE_CONFIG": path}))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cfg.MySQL.MaxOpenConns)
+	assert.Equal(t, 5*time.Second, cfg.HTTP.DrainDelay)
+	assert.Equal(t, "snowflake", cfg.Posts.IDs)
+	assert.Equal(t, int64(7), cfg.Posts.SnowflakeNode)
+	assert.Equal(t, time.Hour, cfg.Posts.ViewsWindow)
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load("test", []string{"-config", writeFile(t, "cfg.yaml", "mysq:\n  dsn: x\n")}, env(nil))
+	assert.Error(t, err, "unknown field")
+
+	_, err = Load("test", []string{"-config", writeFile(t, "cfg.json", "{}")}, env(nil))
+	assert.ErrorIs(t, err, ErrBadFormat)
+
+	_, err = Load("test", nil, env(map[string]string{"REDDITCLONE_TOKEN_TTL": "soon"}))
+	assert.Error(t, err)
+
+	_, err = Load("test", []string{"-no-such-flag"}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.StaticDir = t.TempDir()
+	cfg.MySQL.DSN = testDSN
+	cfg.Auth.Secret = "long enough secret"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Addr = "8080"
+	cfg.MySQL.DSN = ""
+	cfg.Mongo.URI = "http://localhost"
+	cfg.Auth.Secret = "short"
+	cfg.Posts.IDs = "snowflake"
+	cfg.Posts.SnowflakeNode = -1
+	cfg.HTTP.TrustedProxies = []string{"10.0.0.0/8", "proxy"}
+	cfg.Sessions.IdleTimeout = 0
+	cfg.Sessions.CleanupBatch = -1
+	cfg.HTTP.DrainDelay = -time.Second
+	err := cfg.Validate()
+	assert.Error(t, err)
+	for _, problem := range []string{"addr", "mysql dsn", "mongo uri", "jwt secret", "snowflake node", "trusted proxy",
+		"session timeouts", "session cleanup batch", "drain delay"} {
+		assert.True(t, strings.Contains(err.Error(), problem), "%s is not reported: %s", problem, err)
+	}
+
+	cfg = Default()
+	cfg.StaticDir = t.TempDir()
+	cfg.MySQL.DSN = testDSN
+	cfg.Auth.Secret = "long enough secret"
+	cfg.Sessions.Store = "redis"
+	assert.NoError(t, cfg.Validate())
+	cfg.Redis.Addr = "localhost"
+	assert.Contains(t, cfg.Validate().Error(), "redis addr")
+	cfg.Sessions.Store = "memcached"
+	assert.Contains(t, cfg.Validate().Error(), "unknown session store")
+
+	// nothing of the databases is needed in memory
+	cfg.Storage = StorageMemory
+	cfg.MySQL.DSN = ""
+	cfg.Mongo.URI = ""
+	assert.NoError(t, cfg.Validate())
+	cfg.Storage = "disk"
+	assert.Contains(t, cfg.Validate().Error(), "unknown storage")
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/apierror"
+	"redditclone/pkg/comment"
+	"strconv"
+)
+
+// OwnerFunc returns the login of the user who owns the resource the request
+// points to.
+type OwnerFunc func(r *http.Request) (string, error)
+
+// OnlyOwner lets the request reach next only when it comes from the owner of
+// the resource: anonymous callers get 401, everybody else 403.
+func OnlyOwner(owner OwnerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		login, err := owner(r)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		if login != u.Login {
+			apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "forbidden"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// PostOwner resolves the author of the post {POST_ID}.
+func (h *PostHandler) PostOwner(r *http.Request) (string, error) {
+	elem, err := h.PostRepo.Get(mux.Vars(r)["POST_ID"])
+	if err != nil {
+		return "", err
+	}
+	return elem.AuthorID, nil
+}
+
+// CommentOwner resolves the author of the comment {COMMENT_ID} of the post
+// {POST_ID}.
+func (h *PostHandler) CommentOwner(r *http.Request) (string, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["COMMENT_ID"], 10, 64)
+	if err != nil {
+		return "", errBadCommentID
+	}
+	elem, err := h.PostRepo.Get(vars["POST_ID"])
+	if err != nil {
+		return "", err
+	}
+	for _, item := range elem.Comments {
+		if item.ID == id && !item.Deleted {
+			return item.Author.Login, nil
+		}
+	}
+	return "", comment.ErrNoComment
+}
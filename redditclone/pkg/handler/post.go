@@ -2,27 +2,38 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"redditclone/pkg/apierror"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/logging"
+	"redditclone/pkg/middleware"
 	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/repo"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
-	"sort"
+	"redditclone/pkg/validate"
+	"redditclone/pkg/views"
 	"strconv"
-	"strings"
 )
 
 type PostHandler struct {
 	PostRepo post.PostRepo
 	Logger   *zap.SugaredLogger
 	Sessions session.SessRepo
+	Views    *views.Tracker
 }
 
+// logger is the request logger put by middleware.AccessLog.
+func (h *PostHandler) logger(r *http.Request) *zap.SugaredLogger {
+	return logging.FromContext(r.Context(), h.Logger)
+}
+
+// PostForm is what a client may set on a new post, the rest of the post is
+// filled in by the server.
 type PostForm struct {
 	Category string `json:"category"`
 	Text     string `json:"text"`
@@ -34,197 +45,492 @@ type CommentForm struct {
 	Comment string `json:"comment"`
 }
 
-var (
-	AplJSON = "application/json"
+// Categories are the ones the frontend offers.
+var Categories = []string{"music", "funny", "videos", "programming", "news", "fashion"}
+
+const (
+	MaxTitleLen   = 300
+	MaxTextLen    = 40000
+	MaxURLLen     = 2048
+	MaxCommentLen = 10000
 )
 
-type ErrForm struct {
-	Location string `json:"location"`
-	Param    string `json:"param"`
-	Msg      string `json:"msg"`
-	Value    string `json:"value,omitempty"`
+func (f *PostForm) Validate() []ErrForm {
+	return validate.Run("body",
+		validate.Field("title", f.Title, validate.Required, validate.MaxLen(MaxTitleLen)),
+		validate.Field("category", f.Category, validate.Required, validate.OneOf(Categories...)),
+		validate.Field("type", f.Type, validate.Required, validate.OneOf("text", "link")),
+		validate.Field("text", f.Text, validate.Required, validate.MaxLen(MaxTextLen)).When(f.Type == "text"),
+		validate.Field("url", f.URL, validate.Required, validate.MaxLen(MaxURLLen), validate.URL).When(f.Type == "link"),
+	)
 }
 
-func (h *PostHandler) List(w http.ResponseWriter, _ *http.Request) {
-	elems, err := h.PostRepo.GetAll()
-	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
-		return
+// Post builds the new post of author, the type decides whether it keeps the
+// text or the url.
+func (f *PostForm) Post(author *user.User) *post.Post {
+	p := &post.Post{
+		Author:   *author,
+		Category: f.Category,
+		Title:    f.Title,
+		Type:     f.Type,
+	}
+	if f.Type == "link" {
+		p.URL = f.URL
+	} else {
+		p.Text = f.Text
 	}
-	sort.Sort(PostSort(elems))
-	resp, errMarshal := json.Marshal(elems)
-	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
-		return
+	return p
+}
+
+func (f *CommentForm) Validate() []ErrForm {
+	return validate.Run("body",
+		validate.Field("comment", f.Comment, validate.Required, validate.MaxLen(MaxCommentLen)),
+	)
+}
+
+// validateChanges checks only the fields that are changed, whether they fit
+// the type of the post is up to the repo.
+func validateChanges(c *post.Changes) []ErrForm {
+	if c.Empty() {
+		return []ErrForm{{Location: "body", Param: "title", Msg: "title, text or url is required"}}
 	}
-	_, err = w.Write(resp)
-	if err != nil {
-		h.Logger.Infow("Error of write", err)
-		return
+	var title, text, url string
+	if c.Title != nil {
+		title = *c.Title
 	}
+	if c.Text != nil {
+		text = *c.Text
+	}
+	if c.URL != nil {
+		url = *c.URL
+	}
+	return validate.Run("body",
+		validate.Field("title", title, validate.Required, validate.MaxLen(MaxTitleLen)).When(c.Title != nil),
+		validate.Field("text", text, validate.Required, validate.MaxLen(MaxTextLen)).When(c.Text != nil),
+		validate.Field("url", url, validate.Required, validate.MaxLen(MaxURLLen), validate.URL).When(c.URL != nil),
+	)
+}
+
+var (
+	AplJSON = "application/json"
+)
+
+const (
+	DefaultPageLimit = 25
+	MaxPageLimit     = 100
+)
+
+// ErrForm is one invalid field of a request, see apierror.Validation.
+type ErrForm = apierror.FieldError
+
+var (
+	errBadID        = apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "bad id")
+	errBadCommentID = apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "bad comment id")
+)
+
+// errBadPayload answers requests whose body can not be read or decoded.
+func errBadPayload(err error) *apierror.Error {
+	return apierror.Wrap(err, http.StatusBadRequest, apierror.CodeBadJSON, "cant unpack payload")
+}
+
+func (h *PostHandler) List(w http.ResponseWriter, r *http.Request) {
+	page, paged := pageFromQuery(r)
+	elems, err := h.PostRepo.GetAll(page)
+	h.sendListing(w, r, elems, paged, err)
 }
 
 func (h *PostHandler) Category(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	category, err0 := vars["CATEGORY_NAME"]
 	if !err0 {
-		http.Error(w, `{"error": "bad category"}`, http.StatusBadGateway)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "bad category"))
 		return
 	}
-	elems, err := h.PostRepo.GetInCategory(category)
+	page, paged := pageFromQuery(r)
+	elems, err := h.PostRepo.GetInCategory(category, page)
+	h.sendListing(w, r, elems, paged, err)
+}
+
+// pageFromQuery reads the sort order, the limit and the after cursor of a
+// listing. Requests without limit and cursor are not paged and get the whole
+// listing as a plain array.
+func pageFromQuery(r *http.Request) (post.Page, bool) {
+	q := r.URL.Query()
+	page := post.Page{
+		After:  q.Get("after"),
+		Sort:   ranking.Sort(q.Get("sort")),
+		Period: ranking.Period(q.Get("t")),
+	}
+	if q.Get("limit") == "" && page.After == "" {
+		return page, false
+	}
+	page.Limit = int64(queryInt(r, "limit", DefaultPageLimit, MaxPageLimit))
+	return page, true
+}
+
+func (h *PostHandler) sendListing(w http.ResponseWriter, r *http.Request, elems *post.Listing, paged bool, err error) {
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
-	sort.Sort(PostSort(elems))
-	resp, err2 := json.Marshal(elems)
-	if err2 != nil {
-		h.Logger.Infow("Error of marshal", err2)
+	var body interface{} = elems
+	if !paged {
+		body = elems.Posts
+	}
+	resp, errMarshal := json.Marshal(body)
+	if errMarshal != nil {
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
 		return
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
-
 }
 
 func (h *PostHandler) Get(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err0 := vars["POST_ID"]
 	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+		apierror.Write(w, r, errBadID)
 		return
 	}
+	from := comment.Cursor{Parent: comment.Root, After: comment.Root}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		var errCursor error
+		from, errCursor = comment.ParseCursor(c)
+		if errCursor != nil {
+			apierror.Write(w, r, errCursor)
+			return
+		}
+	}
+	depth := queryInt(r, "depth", comment.DefaultDepth, comment.MaxDepth)
+	limit := queryInt(r, "limit", comment.DefaultLimit, comment.MaxLimit)
+
 	elem, err := h.PostRepo.Get(id)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
+	if h.Views.Count(elem.ID, viewerKey(r)) {
+		views, errView := h.PostRepo.AddView(elem.ID)
+		if errView != nil {
+			h.logger(r).Infow("Error of counting view", errView)
+		} else {
+			elem.Views = views
+		}
+	}
 
-	resp, errMrsh := json.Marshal(elem)
+	resp, errMrsh := json.Marshal(NewPostThread(elem, from, depth, limit))
 	if errMrsh != nil {
-		h.Logger.Infow("Error of Marshal", errMrsh)
+		h.logger(r).Infow("Error of Marshal", errMrsh)
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
+
+// viewerKey tells who looks at a post for counting views: the logged in
+// user, else the session checked by middleware.Auth, else the client address
+// found behind the trusted proxies. The cookies are not believed, a client
+// could count a view per made up session id.
+func viewerKey(r *http.Request) string {
+	if u, err := user.UserFromContext(r.Context()); err == nil {
+		return "user:" + u.Login
+	}
+	if sess, err := session.SessionFromContext(r.Context()); err == nil {
+		return "session:" + sess.ID
+	}
+	return "addr:" + middleware.RequestClientIP(r)
+}
+
+// PostThread is a post with its comments arranged in threads.
+type PostThread struct {
+	*post.Post
+	Comments       []*comment.Thread `json:"comments"`
+	CommentsCursor string            `json:"commentsCursor,omitempty"`
+}
+
+func NewPostThread(p *post.Post, from comment.Cursor, depth, limit int) *PostThread {
+	threads, next := comment.BuildTree(p.Comments, from, depth, limit)
+	return &PostThread{
+		Post:           p,
+		Comments:       threads,
+		CommentsCursor: next,
+	}
+}
+
+// queryInt reads a positive number from the query string, falling back to def
+// when it is missing or invalid and capping it at max.
+func queryInt(r *http.Request, name string, def, max int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || n < 1 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
 func (h *PostHandler) Add(w http.ResponseWriter, r *http.Request) {
 
 	body, err1 := ioutil.ReadAll(r.Body)
 	if err1 != nil {
-		h.Logger.Infow("Error of Read body", err1)
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, errBadPayload(err1))
 		return
 	}
 	err := r.Body.Close()
 	if err != nil {
-		h.Logger.Infow("Error of close req body", err)
-		http.Error(w, `DB err`, http.StatusInternalServerError)
-		return
+		h.logger(r).Infow("Error of close req body", err)
 	}
 
-	item := &post.Post{}
-	err0 := json.Unmarshal(body, item)
+	form := &PostForm{}
+	err0 := json.Unmarshal(body, form)
 	if err0 != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
-		jsonError(w, http.StatusBadRequest, "cant unpack payload")
+		apierror.Write(w, r, errBadPayload(err0))
+		return
+	}
+	if errs := form.Validate(); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
 		return
 	}
 
-	inToken := r.Header.Get("authorization")
-	u := GetUserFromToken(inToken)
-	item.Author = *u
-	ans, err1 := h.PostRepo.Add(item)
+	u, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	ans, err1 := h.PostRepo.Add(form.Post(u))
 	if err1 != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err1)
 		return
 	}
 	_, err4 := h.PostRepo.UpdateVote(int(1), ans.ID, u)
 	if err4 != nil {
-		h.Logger.Infow("Err in UpdateVote: ", err4)
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err4)
 		return
 	}
 
 	resp, err3 := json.Marshal(ans)
 	if err3 != nil {
-		h.Logger.Infow("Error of Marshal: ", err3)
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err3)
 		return
 	}
+	w.Header().Set("Content-Type", AplJSON)
+	w.WriteHeader(http.StatusCreated)
 	_, err2 := w.Write(resp)
 	if err2 != nil {
-		h.Logger.Infow("Error of write", err2)
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		h.logger(r).Infow("Error of write", err2)
+		return
+	}
+}
+
+func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
+	body, err1 := ioutil.ReadAll(r.Body)
+	if err1 != nil {
+		apierror.Write(w, r, errBadPayload(err1))
+		return
+	}
+	err := r.Body.Close()
+	if err != nil {
+		h.logger(r).Infow("Error of close req body", err)
+	}
+
+	vars := mux.Vars(r)
+	idPost, err0 := vars["POST_ID"]
+	if !err0 {
+		apierror.Write(w, r, errBadID)
+		return
+	}
+
+	changes := &post.Changes{}
+	err = json.Unmarshal(body, changes)
+	if err != nil {
+		apierror.Write(w, r, errBadPayload(err))
+		return
+	}
+	if errs := validateChanges(changes); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
+		return
+	}
+
+	u, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	elem, err := h.PostRepo.Update(idPost, changes, u)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	resp, errMarshal := json.Marshal(elem)
+	if errMarshal != nil {
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
+	}
+	_, err = w.Write(resp)
+	if err != nil {
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
-	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 
 	body, err3 := ioutil.ReadAll(r.Body)
 	if err3 != nil {
-		h.Logger.Infow("Error of Reading body", err3)
+		apierror.Write(w, r, errBadPayload(err3))
+		return
 	}
 	err1 := r.Body.Close()
 	if err1 != nil {
-		h.Logger.Infow("Error of close req body", err1)
-		return
+		h.logger(r).Infow("Error of close req body", err1)
 	}
 
 	vars := mux.Vars(r)
 	id, err0 := vars["POST_ID"]
 	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+		apierror.Write(w, r, errBadID)
 		return
 	}
 
 	item := &CommentForm{}
 	err := json.Unmarshal(body, item)
 	if err != nil {
-		jsonError(w, http.StatusBadRequest, "cant unpack payload")
-		return
-	}
-	if item.Comment == "" {
-		Arr, errM := json.Marshal(map[string][]ErrForm{
-			"errors": {
-				{
-					Location: "body",
-					Param:    "comment",
-					Msg:      "is required",
-				},
-			}})
-		if errM != nil {
-			h.Logger.Infow("Error in Marshaling response", errM)
-		}
-		http.Error(w, "", http.StatusUnprocessableEntity)
-		_, err = w.Write(Arr)
-		if err != nil {
-			h.Logger.Infow("Error of write", err)
-			return
-		}
+		apierror.Write(w, r, errBadPayload(err))
+		return
+	}
+	if errs := item.Validate(); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
+		return
+	}
+	u, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
-	inToken := r.Header.Get("authorization")
-	u := GetUserFromToken(inToken)
 	elem, err := h.PostRepo.AddComment(id, item.Comment, u)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
+		return
+	}
+	resp, errMarshal := json.Marshal(elem)
+	if errMarshal != nil {
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
+	}
+	_, err = w.Write(resp)
+	if err != nil {
+		h.logger(r).Infow("Error of write", err)
+		return
+	}
+}
+
+func (h *PostHandler) Reply(w http.ResponseWriter, r *http.Request) {
+
+	body, err3 := ioutil.ReadAll(r.Body)
+	if err3 != nil {
+		apierror.Write(w, r, errBadPayload(err3))
+		return
+	}
+	err1 := r.Body.Close()
+	if err1 != nil {
+		h.logger(r).Infow("Error of close req body", err1)
+	}
+
+	vars := mux.Vars(r)
+	idPost, err0 := vars["POST_ID"]
+	if !err0 {
+		apierror.Write(w, r, errBadID)
+		return
+	}
+	idComment, errConv := strconv.ParseInt(vars["COMMENT_ID"], 10, 64)
+	if errConv != nil {
+		apierror.Write(w, r, errBadCommentID)
+		return
+	}
+
+	item := &CommentForm{}
+	err := json.Unmarshal(body, item)
+	if err != nil {
+		apierror.Write(w, r, errBadPayload(err))
+		return
+	}
+	if errs := item.Validate(); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
+		return
+	}
+	u, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	elem, err := h.PostRepo.AddReply(idPost, idComment, item.Comment, u)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	resp, errMarshal := json.Marshal(elem)
+	if errMarshal != nil {
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
+	}
+	_, err = w.Write(resp)
+	if err != nil {
+		h.logger(r).Infow("Error of write", err)
+		return
+	}
+}
+
+func (h *PostHandler) EditComment(w http.ResponseWriter, r *http.Request) {
+
+	body, err3 := ioutil.ReadAll(r.Body)
+	if err3 != nil {
+		apierror.Write(w, r, errBadPayload(err3))
+		return
+	}
+	err1 := r.Body.Close()
+	if err1 != nil {
+		h.logger(r).Infow("Error of close req body", err1)
+	}
+
+	vars := mux.Vars(r)
+	idPost, err0 := vars["POST_ID"]
+	if !err0 {
+		apierror.Write(w, r, errBadID)
+		return
+	}
+	idComment, errConv := strconv.ParseInt(vars["COMMENT_ID"], 10, 64)
+	if errConv != nil {
+		apierror.Write(w, r, errBadCommentID)
+		return
+	}
+
+	item := &CommentForm{}
+	err := json.Unmarshal(body, item)
+	if err != nil {
+		apierror.Write(w, r, errBadPayload(err))
+		return
+	}
+	if errs := item.Validate(); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
+		return
+	}
+	u, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	elem, err := h.PostRepo.EditComment(idPost, idComment, item.Comment, u)
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 	resp, errMarshal := json.Marshal(elem)
 	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
@@ -234,27 +540,26 @@ func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idPost, err6 := vars["POST_ID"]
 	if !err6 {
-		h.Logger.Infow("Error in Vars/Delate")
+		apierror.Write(w, r, errBadID)
+		return
 	}
-
-	idComment, err0 := vars["COMMENT_ID"]
-	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+	idComment, errConv := strconv.ParseInt(vars["COMMENT_ID"], 10, 64)
+	if errConv != nil {
+		apierror.Write(w, r, errBadCommentID)
 		return
 	}
-	id1, _ := strconv.Atoi(idComment)
-	elem, err := h.PostRepo.DeleteComment(idPost, int64(id1))
+	elem, err := h.PostRepo.DeleteComment(idPost, idComment)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 	resp, errMarshal := json.Marshal(elem)
 	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
@@ -263,30 +568,27 @@ func (h *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idPost, err0 := vars["POST_ID"]
 	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+		apierror.Write(w, r, errBadID)
 		return
 	}
-	inToken := r.Header.Get("authorization")
-	u := GetUserFromToken(inToken)
-	elem, err := h.PostRepo.UpdateVote(1, idPost, u)
-	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+	u, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
-
+	elem, err := h.PostRepo.UpdateVote(1, idPost, u)
 	if err != nil {
-		http.Error(w, `Template error`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	resp, errMarshal := json.Marshal(elem)
 	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
 		return
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
@@ -295,24 +597,25 @@ func (h *PostHandler) Downvote(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idPost, err0 := vars["POST_ID"]
 	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+		apierror.Write(w, r, errBadID)
+		return
+	}
+	u, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
-	inToken := r.Header.Get("authorization")
-
-	u := GetUserFromToken(inToken)
 	elem, err := h.PostRepo.UpdateVote(-1, idPost, u)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 	resp, errMarshal := json.Marshal(elem)
 	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
@@ -321,53 +624,38 @@ func (h *PostHandler) Unvote(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idPost, err0 := vars["POST_ID"]
 	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+		apierror.Write(w, r, errBadID)
 		return
 	}
-	inToken := r.Header.Get("authorization")
-
-	u := GetUserFromToken(inToken)
-	elem, err := h.PostRepo.UpdateVote(0, idPost, u)
-	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+	u, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
+	elem, err := h.PostRepo.UpdateVote(0, idPost, u)
 	if err != nil {
-		http.Error(w, `Template error`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 	resp, errMarshal := json.Marshal(elem)
 	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
 
-func GetUserFromToken(inToken string) *user.User {
-	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
-		method, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok || method.Alg() != "HS256" {
-			return nil, fmt.Errorf("bad sign method")
-		}
-		return ExampleTokenSecret, nil
-	}
-	inToken = strings.Split(inToken, " ")[1]
-	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(inToken, claims, hashSecretGetter)
+// currentUser returns the user put into the context by middleware.Auth and
+// answers 401 when there is none.
+func currentUser(w http.ResponseWriter, r *http.Request) (*user.User, bool) {
+	u, err := user.UserFromContext(r.Context())
 	if err != nil {
-		log.Println(err.Error())
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized"))
+		return nil, false
 	}
-
-	op := claims["user"].(map[string]interface{})
-	u := &user.User{
-		Login: op["username"].(string),
-		ID:    int64(op["id"].(float64)),
-	}
-	return u
+	return u, true
 }
 
 func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
@@ -375,18 +663,21 @@ func (h *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idPost, err0 := vars["POST_ID"]
 	if !err0 {
-		http.Error(w, `{"error": "bad id"}`, http.StatusBadGateway)
+		apierror.Write(w, r, errBadID)
 		return
 	}
 	ok, err := h.PostRepo.Delete(idPost)
+	if err == nil && !ok {
+		err = repo.ErrNoPost
+	}
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
-	if ok {
-		jsonError(w, http.StatusOK, "success")
-	} else {
-		jsonError(w, http.StatusInternalServerError, "error of delete")
+	w.Header().Set("Content-Type", AplJSON)
+	_, err = w.Write([]byte(`{"message":"success"}`))
+	if err != nil {
+		h.logger(r).Infow("Error of write", err)
 	}
 }
 
@@ -394,28 +685,33 @@ func (h *PostHandler) GetPostsOfUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID, err0 := vars["USER_LOGIN"]
 	if !err0 {
-		http.Error(w, `{"error": "bad category"}`, http.StatusBadGateway)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeBadRequest, "bad category"))
 		return
 	}
+	page, paged := pageFromQuery(r)
+	elems, err := h.PostRepo.GetFromUser(userID, page)
+	h.sendListing(w, r, elems, paged, err)
+}
 
-	elems, err := h.PostRepo.GetFromUser(userID)
+// Search finds posts by the words of the q parameter in their title, text and
+// comments, optionally only in a category or from an author.
+func (h *PostHandler) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := post.Filter{Category: q.Get("category"), AuthorID: q.Get("author")}
+	limit := int64(queryInt(r, "limit", DefaultPageLimit, MaxPageLimit))
+	elems, err := h.PostRepo.Search(q.Get("q"), filter, limit)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 	resp, errMarshal := json.Marshal(elems)
 	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
+		h.logger(r).Infow("Error in Marshaling response", errMarshal)
+		return
 	}
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
-
-type PostSort []*post.Post
-
-func (a PostSort) Len() int           { return len(a) }
-func (a PostSort) Less(i, j int) bool { return a[i].Score > a[j].Score }
-func (a PostSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
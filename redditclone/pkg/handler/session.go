@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/apierror"
+	"redditclone/pkg/middleware"
+	"redditclone/pkg/session"
+	"time"
+)
+
+// SessionInfo is a session as the user sees it, ID is the public ID that
+// revokes it.
+type SessionInfo struct {
+	ID        string `json:"id"`
+	Created   string `json:"created"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	Current   bool   `json:"current"`
+}
+
+// clientOf describes the device of the request for a new session.
+func clientOf(r *http.Request) session.Client {
+	return session.Client{
+		UserAgent: r.UserAgent(),
+		IP:        middleware.RequestClientIP(r),
+	}
+}
+
+// currentSession is the session of the request token, the routes are
+// wrapped with middleware.RequireAuth so it is always there.
+func currentSession(w http.ResponseWriter, r *http.Request) (*session.Session, bool) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		apierror.Write(w, r, err)
+		return nil, false
+	}
+	return sess, true
+}
+
+func (h *UserHandler) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", AplJSON)
+	_, err = w.Write(resp)
+	if err != nil {
+		h.logger(r).Infow("Error of write", err)
+	}
+}
+
+// Logout destroys the session of the request and its cookie, the tokens of
+// the session stop working.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.Sessions.DestroyCurrent(w, r); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	h.writeJSON(w, r, map[string]string{"message": "success"})
+}
+
+// LogoutAll destroys every session of the user, on every device.
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	current, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Sessions.DestroyAll(current.UserID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	session.ClearCookie(w)
+	h.writeJSON(w, r, map[string]string{"message": "success"})
+}
+
+// ListSessions shows the active sessions of the user.
+func (h *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	current, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.Sessions.List(current.UserID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	infos := make([]SessionInfo, 0, len(list))
+	for _, sess := range list {
+		infos = append(infos, SessionInfo{
+			ID:        sess.PublicID(),
+			Created:   sess.Created.Format(time.RFC3339),
+			UserAgent: sess.UserAgent,
+			IP:        sess.IP,
+			Current:   sess.ID == current.ID,
+		})
+	}
+	h.writeJSON(w, r, map[string]interface{}{"sessions": infos})
+}
+
+// RevokeSession destroys one session of the user by its public ID, the
+// sessions of other users are not found.
+func (h *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	current, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["SESSION_ID"]
+	list, err := h.Sessions.List(current.UserID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	for _, sess := range list {
+		if sess.PublicID() != id {
+			continue
+		}
+		if err := h.Sessions.Destroy(sess.ID); err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		h.writeJSON(w, r, map[string]string{"message": "success"})
+		return
+	}
+	apierror.Write(w, r, session.ErrNoSession)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/session"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withSession(r *http.Request, sess *session.Session) *http.Request {
+	return r.WithContext(session.NewContext(r.Context(), sess))
+}
+
+func TestUserLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sess := session.NewMockSessRepo(ctrl)
+	service := &UserHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Sessions: sess,
+	}
+	current := &session.Session{ID: "s1", UserID: 3}
+
+	req := withSession(httptest.NewRequest("POST", "/api/logout", nil), current)
+	w := httptest.NewRecorder()
+	sess.EXPECT().DestroyCurrent(w, req).Return(nil)
+	service.Logout(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	sess.EXPECT().DestroyCurrent(w, req).Return(fmt.Errorf("bad query"))
+	service.Logout(w, req)
+	if w.Code != 500 {
+		t.Errorf("expected resp status 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	sess.EXPECT().DestroyAll(int64(3)).Return(nil)
+	service.LogoutAll(w, withSession(httptest.NewRequest("POST", "/api/logout/all", nil), current))
+	if w.Code != 200 || !strings.Contains(w.Header().Get("Set-Cookie"), "session_id=") {
+		t.Errorf("expected resp status 200 and an expired cookie, got %d", w.Code)
+	}
+
+	// without a session there is nothing to log out from
+	w = httptest.NewRecorder()
+	service.LogoutAll(w, httptest.NewRequest("POST", "/api/logout/all", nil))
+	if w.Code != 401 {
+		t.Errorf("expected resp status 401, got %d", w.Code)
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sess := session.NewMockSessRepo(ctrl)
+	service := &UserHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Sessions: sess,
+	}
+	created := time.Date(2022, 5, 10, 13, 31, 10, 0, time.UTC)
+	list := []*session.Session{
+		{ID: "s1", UserID: 3, Created: created, UserAgent: "curl", IP: "1.2.3.4", RefreshHash: "secret"},
+		{ID: "s2", UserID: 3, Created: created.Add(-time.Hour), UserAgent: "firefox", IP: "5.6.7.8"},
+	}
+
+	sess.EXPECT().List(int64(3)).Return(list, nil)
+	w := httptest.NewRecorder()
+	service.ListSessions(w, withSession(httptest.NewRequest("GET", "/api/sessions", nil), list[0]))
+	body := struct{ Sessions []SessionInfo }{}
+	if err := json.NewDecoder(w.Result().Body).Decode(&body); err != nil || w.Code != 200 {
+		t.Fatalf("expected the sessions, got %d: %v", w.Code, err)
+	}
+	expected := []SessionInfo{
+		{ID: list[0].PublicID(), Created: "2022-05-10T13:31:10Z", UserAgent: "curl", IP: "1.2.3.4", Current: true},
+		{ID: list[1].PublicID(), Created: "2022-05-10T12:31:10Z", UserAgent: "firefox", IP: "5.6.7.8"},
+	}
+	if fmt.Sprint(body.Sessions) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, body.Sessions)
+	}
+	if strings.Contains(w.Body.String(), "s1") || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("session secrets leaked: %s", w.Body.String())
+	}
+
+	revoke := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/api/sessions/"+id, nil)
+		req = mux.SetURLVars(withSession(req, list[0]), map[string]string{"SESSION_ID": id})
+		w := httptest.NewRecorder()
+		service.RevokeSession(w, req)
+		return w
+	}
+	sess.EXPECT().List(int64(3)).Return(list, nil)
+	sess.EXPECT().Destroy("s2").Return(nil)
+	if w := revoke(list[1].PublicID()); w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+	// the raw id of the cookie does not name a session
+	sess.EXPECT().List(int64(3)).Return(list, nil)
+	if w := revoke("s2"); w.Code != 404 {
+		t.Errorf("expected resp status 404, got %d", w.Code)
+	}
+	sess.EXPECT().List(int64(3)).Return(nil, fmt.Errorf("bad query"))
+	if w := revoke(list[1].PublicID()); w.Code != 500 {
+		t.Errorf("expected resp status 500, got %d", w.Code)
+	}
+}
@@ -2,14 +2,16 @@ package handler
 
 import (
 	"encoding/json"
-	"github.com/dgrijalva/jwt-go"
 	"go.uber.org/zap"
-	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"redditclone/pkg/apierror"
+	"redditclone/pkg/logging"
 	"redditclone/pkg/session"
+	"redditclone/pkg/token"
 	"redditclone/pkg/user"
+	"redditclone/pkg/validate"
+	"regexp"
 	"time"
 )
 
@@ -17,173 +19,214 @@ type UserHandler struct {
 	UserRepo user.UserRepo
 	Logger   *zap.SugaredLogger
 	Sessions session.SessRepo
+	// TokenSecret signs the issued tokens, middleware.Auth checks them with
+	// the same secret. TokenTTL is their lifetime.
+	TokenSecret []byte
+	TokenTTL    time.Duration
 }
 
-var (
-	ExampleTokenSecret = []byte("супер секретный ключ")
-)
+// logger is the request logger put by middleware.AccessLog.
+func (h *UserHandler) logger(r *http.Request) *zap.SugaredLogger {
+	return logging.FromContext(r.Context(), h.Logger)
+}
 
 type LoginForm struct {
 	Login    string `json:"username"`
 	Password string `json:"password"`
 }
 
-func jsonError(w io.Writer, status int, msg string) {
-	resp, errMarshal := json.Marshal(map[string]interface{}{
-		"status": status,
-		"error":  msg,
-	})
-	if errMarshal != nil {
-		log.Println("Error in Marshaling response", errMarshal)
-		return
-	}
-	_, err := w.Write(resp)
-	if err != nil {
-		log.Println("Error of write", err)
-		return
-	}
+const (
+	MinUsernameLen = 3
+	MaxUsernameLen = 32
+	MinPasswordLen = 8
+	// MaxPasswordBytes is what bcrypt hashes, the rest would be ignored.
+	MaxPasswordBytes = 72
+)
+
+var usernameChars = regexp.MustCompile(`^[a-zA-Z0-9_-]*$`)
+
+// Validate is the policy of new accounts.
+func (f *LoginForm) Validate() []ErrForm {
+	return validate.Run("body",
+		validate.Field("username", f.Login, validate.Required,
+			validate.MinLen(MinUsernameLen), validate.MaxLen(MaxUsernameLen),
+			validate.Match(usernameChars, "may contain only latin letters, digits, _ and -")),
+		validate.Secret("password", f.Password, validate.Required,
+			validate.MinLen(MinPasswordLen), validate.MaxBytes(MaxPasswordBytes)),
+	)
+}
+
+// validateLogin only checks that the credentials are given, accounts created
+// before the policy must still be able to log in.
+func (f *LoginForm) validateLogin() []ErrForm {
+	return validate.Run("body",
+		validate.Field("username", f.Login, validate.Required),
+		validate.Secret("password", f.Password, validate.Required),
+	)
 }
 
+// RefreshForm carries the refresh token given out with the access token.
+type RefreshForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var errBadCredentials = apierror.New(http.StatusUnauthorized, apierror.CodeBadCredentials, "bad login or password")
+
 func (h *UserHandler) Re(w http.ResponseWriter, r *http.Request) {
 	body, errRead := ioutil.ReadAll(r.Body)
 	if errRead != nil {
-		h.Logger.Infow("err in Re", errRead)
+		apierror.Write(w, r, errBadPayload(errRead))
 		return
 	}
 	err1 := r.Body.Close()
 	if err1 != nil {
-		h.Logger.Infow("Error of close req body", err1)
-		return
+		h.logger(r).Infow("Error of close req body", err1)
 	}
 	fd := &LoginForm{}
 	err := json.Unmarshal(body, fd)
 	if err != nil {
-		jsonError(w, http.StatusBadRequest, "cant unpack payload")
+		apierror.Write(w, r, errBadPayload(err))
+		return
+	}
+	if errs := fd.validateLogin(); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
 		return
 	}
 
 	us, exist := h.UserRepo.Authorize(fd.Login, fd.Password)
-	if exist != nil {
-		h.Logger.Infow(exist.Error())
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		jsonError(w, http.StatusUnauthorized, "bad login or password")
+	switch exist {
+	case nil:
+	case user.ErrNoUser, user.ErrBadPass:
+		// the client is not told which one of them is wrong
+		h.logger(r).Infow(exist.Error())
+		apierror.Write(w, r, errBadCredentials)
+		return
+	default:
+		apierror.Write(w, r, exist)
 		return
 	}
-	_, errCreate := h.Sessions.Create(w, us.ID)
+	sess, errCreate := h.Sessions.Create(w, us.ID, clientOf(r))
 	if errCreate != nil {
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
+		apierror.Write(w, r, errCreate)
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": map[string]interface{}{
-			"username": us.Login,
-			"id":       us.ID,
-		},
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Unix() + 1200,
-	})
-	tokenString, err := token.SignedString(ExampleTokenSecret)
-	if err != nil {
-		jsonError(w, http.StatusInternalServerError, err.Error())
+	h.sendTokens(w, r, us, sess)
+}
+
+func (h *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
+	body, errRead := ioutil.ReadAll(r.Body)
+	if errRead != nil {
+		apierror.Write(w, r, errBadPayload(errRead))
 		return
 	}
+	err1 := r.Body.Close()
+	if err1 != nil {
+		h.logger(r).Infow("Error of close req body", err1)
+	}
 
-	resp, errMrsh := json.Marshal(map[string]interface{}{
-		"token": tokenString,
-	})
-	if errMrsh != nil {
-		h.Logger.Infow("Err of Marshal", errMrsh)
+	fd := &LoginForm{}
+	err := json.Unmarshal(body, fd)
+	if err != nil {
+		apierror.Write(w, r, errBadPayload(err))
 		return
 	}
-	_, err = w.Write(resp)
-	if err != nil {
-		h.Logger.Infow("Error of write", err)
+	if errs := fd.Validate(); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
 		return
 	}
+	_, errUser := h.UserRepo.Authorize(fd.Login, fd.Password)
+	switch errUser {
+	case user.ErrNoUser:
+	case nil, user.ErrBadPass:
+		apierror.Write(w, r, apierror.Validation(ErrForm{
+			Location: "body",
+			Msg:      "already exists",
+			Param:    "username",
+			Value:    fd.Login,
+		}))
+		return
+	default:
+		apierror.Write(w, r, errUser)
+		return
+	}
+	us, exist := h.UserRepo.AddUserInRepo(fd.Login, fd.Password)
+	if exist != nil {
+		apierror.Write(w, r, exist)
+		return
+	}
+	sess, errCreate := h.Sessions.Create(w, us.ID, clientOf(r))
+	if errCreate != nil {
+		apierror.Write(w, r, errCreate)
+		return
+	}
+	h.sendTokens(w, r, us, sess)
 }
 
-func (h *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
+// Refresh trades a refresh token for a new access token and a new refresh
+// token, the old one can not be used again.
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	body, errRead := ioutil.ReadAll(r.Body)
 	if errRead != nil {
-		h.Logger.Infow("err in RegisterPage", errRead)
+		apierror.Write(w, r, errBadPayload(errRead))
 		return
 	}
 	err1 := r.Body.Close()
 	if err1 != nil {
-		h.Logger.Infow("Error of close req body", err1)
+		h.logger(r).Infow("Error of close req body", err1)
+	}
+	fd := &RefreshForm{}
+	err := json.Unmarshal(body, fd)
+	if err != nil {
+		apierror.Write(w, r, errBadPayload(err))
+		return
+	}
+	if errs := validate.Run("body", validate.Secret("refresh_token", fd.RefreshToken, validate.Required)); errs != nil {
+		apierror.Write(w, r, apierror.Validation(errs...))
 		return
 	}
 
-	fd := &LoginForm{}
-	err := json.Unmarshal(body, fd)
+	sess, err := h.Sessions.Refresh(fd.RefreshToken)
 	if err != nil {
-		jsonError(w, http.StatusBadRequest, "cant unpack payload")
-		return
-	}
-	t, errUser := h.UserRepo.Authorize(fd.Login, fd.Password)
-	if errUser != user.ErrNoUser {
-		if t != nil && errUser != user.ErrBadPass {
-			Arr, errM := json.Marshal(map[string][]ErrForm{
-				"errors": {
-					{
-						Location: "body",
-						Msg:      "already exists",
-						Param:    "username",
-						Value:    fd.Login,
-					},
-				}})
-			if errM != nil {
-				h.Logger.Infow("Error in Marshaling response", errM)
-			}
-			http.Error(w, "Empty comment", http.StatusUnprocessableEntity)
-			_, err = w.Write(Arr)
-			if err != nil {
-				h.Logger.Infow("Error of write", err)
-				return
-			}
-			return
-		} else {
-			http.Error(w, "err in Autorise", http.StatusInternalServerError)
-			return
+		if err == session.ErrRefreshReused {
+			h.logger(r).Warnw("refresh token reused, session destroyed", "err", err)
 		}
-	}
-	us, exist := h.UserRepo.AddUserInRepo(fd.Login, fd.Password)
-	if exist != nil {
-		h.Logger.Infow(exist.Error())
-		http.Error(w, "bad login or password", http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
-	_, errCreate := h.Sessions.Create(w, us.ID)
-	if errCreate != nil {
-		h.Logger.Infow("errin Create:", errCreate)
-		http.Error(w, "err in Create", http.StatusInternalServerError)
+	us, err := h.UserRepo.GetByID(sess.UserID)
+	if err == user.ErrNoUser {
+		err = session.ErrNoAuth
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": map[string]interface{}{
-			"username": us.Login,
-			"id":       us.ID,
-		},
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Unix() + 1200,
-	})
-	tokenString, err := token.SignedString(ExampleTokenSecret)
+	h.sendTokens(w, r, us, sess)
+}
+
+// sendTokens answers with a new access token of us in sess and the refresh
+// token of sess.
+func (h *UserHandler) sendTokens(w http.ResponseWriter, r *http.Request, us *user.User, sess *session.Session) {
+	tokenString, err := token.Issue(h.TokenSecret, us, sess.ID, h.TokenTTL)
 	if err != nil {
-		jsonError(w, http.StatusInternalServerError, err.Error())
+		apierror.Write(w, r, err)
 		return
 	}
 
 	resp, errMrsh := json.Marshal(map[string]interface{}{
-		"token": tokenString,
+		"token":         tokenString,
+		"refresh_token": sess.RefreshToken,
+		"expires_in":    int64(h.TokenTTL / time.Second),
 	})
 	if errMrsh != nil {
-		h.Logger.Infow("Err of Marshal", errMrsh)
+		h.logger(r).Infow("Err of Marshal", errMrsh)
 		return
 	}
-
+	w.Header().Set("Content-Type", AplJSON)
+	w.Header().Set("Cache-Control", "no-store")
 	_, err = w.Write(resp)
 	if err != nil {
-		h.Logger.Infow("Error of write", err)
+		h.logger(r).Infow("Error of write", err)
 		return
 	}
 }
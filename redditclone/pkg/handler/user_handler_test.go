@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/golang/mock/gomock"
 	"go.uber.org/zap"
 	"net/http/httptest"
 	"redditclone/pkg/session"
+	"redditclone/pkg/token"
 	"redditclone/pkg/user"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestUserLoginPage(t *testing.T) {
@@ -28,15 +31,15 @@ func TestUserLoginPage(t *testing.T) {
 	}
 
 	arrUser := []*user.User{
-		&user.User{0,
-			"qwerty",
-			"asdfghjk"},
+		&user.User{ID: 0,
+			Login:    "qwerty",
+			Password: "asdfghjk"},
 	}
 	w := httptest.NewRecorder()
 	// тут мы записываем последовтаельность вызовов и результат
 	st.EXPECT().Authorize(arrUser[0].Login, arrUser[0].Password).
 		Return(arrUser[0], nil)
-	sess.EXPECT().Create(w, arrUser[0].ID).Return(&session.Session{}, nil)
+	sess.EXPECT().Create(w, arrUser[0].ID, gomock.Any()).Return(&session.Session{}, nil)
 
 	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "qwerty", "password": "asdfghjk"}`))
 
@@ -51,7 +54,7 @@ func TestUserLoginPage(t *testing.T) {
 	// GetPhotos error
 	// тут мы записываем последовтаельность вызовов и результат
 	st.EXPECT().Authorize(arrUser[0].Login, arrUser[0].Password).
-		Return(nil, fmt.Errorf("no results"))
+		Return(nil, user.ErrBadPass)
 
 	req1 := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "qwerty", "password": "asdfghjk"}`))
 
@@ -67,7 +70,7 @@ func TestUserLoginPage(t *testing.T) {
 
 	st.EXPECT().Authorize(arrUser[0].Login, arrUser[0].Password).
 		Return(arrUser[0], nil)
-	sess.EXPECT().Create(w, arrUser[0].ID).Return(nil, fmt.Errorf("bad sess create"))
+	sess.EXPECT().Create(w, arrUser[0].ID, gomock.Any()).Return(nil, fmt.Errorf("bad sess create"))
 
 	req2 := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "qwerty", "password": "asdfghjk"}`))
 
@@ -97,9 +100,9 @@ func TestUserRegisterPage(t *testing.T) {
 	}
 
 	arrUser := []*user.User{
-		&user.User{0,
-			"qwerty",
-			"asdfghjk"},
+		&user.User{ID: 0,
+			Login:    "qwerty",
+			Password: "asdfghjk"},
 	}
 
 	w := httptest.NewRecorder()
@@ -108,7 +111,7 @@ func TestUserRegisterPage(t *testing.T) {
 		Return(nil, user.ErrNoUser)
 	st.EXPECT().AddUserInRepo(arrUser[0].Login, arrUser[0].Password).
 		Return(arrUser[0], nil)
-	sess.EXPECT().Create(w, arrUser[0].ID).
+	sess.EXPECT().Create(w, arrUser[0].ID, gomock.Any()).
 		Return(&session.Session{}, nil)
 	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"username": "qwerty", "password": "asdfghjk"}`))
 
@@ -142,7 +145,7 @@ func TestUserRegisterPage(t *testing.T) {
 
 	st.EXPECT().AddUserInRepo(arrUser[0].Login, arrUser[0].Password).
 		Return(arrUser[0], nil)
-	sess.EXPECT().Create(w2, int64(arrUser[0].ID)).Return(nil, fmt.Errorf("bad sess create"))
+	sess.EXPECT().Create(w2, int64(arrUser[0].ID), gomock.Any()).Return(nil, fmt.Errorf("bad sess create"))
 
 	req2 := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"username": "qwerty", "password": "asdfghjk"}`))
 
@@ -167,3 +170,90 @@ func TestUserRegisterPage(t *testing.T) {
 	}
 
 }
+
+func TestUserRegisterValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service := &UserHandler{
+		UserRepo: user.NewMockUserRepo(ctrl),
+		Logger:   zap.NewNop().Sugar(),
+		Sessions: session.NewMockSessRepo(ctrl),
+	}
+
+	req := httptest.NewRequest("POST", "/api/register", strings.NewReader(`{"username": "a b", "password": "short"}`))
+	w := httptest.NewRecorder()
+	service.RegisterPage(w, req)
+	body := struct{ Errors []ErrForm }{}
+	if err := json.NewDecoder(w.Result().Body).Decode(&body); err != nil || w.Code != 422 {
+		t.Fatalf("expected one 422 json body, got %d: %v", w.Code, err)
+	}
+	if len(body.Errors) != 2 || body.Errors[0].Param != "username" || body.Errors[1].Param != "password" {
+		t.Errorf("unexpected field errors %v", body.Errors)
+	}
+	if body.Errors[1].Value != "" {
+		t.Errorf("password is echoed back")
+	}
+
+	req = httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "qwerty"}`))
+	w = httptest.NewRecorder()
+	service.Re(w, req)
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+	}
+}
+
+func TestUserRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := user.NewMockUserRepo(ctrl)
+	sess := session.NewMockSessRepo(ctrl)
+	service := &UserHandler{
+		UserRepo:    st,
+		Logger:      zap.NewNop().Sugar(),
+		Sessions:    sess,
+		TokenSecret: []byte("test secret of the tokens"),
+		TokenTTL:    time.Minute,
+	}
+
+	sess.EXPECT().Refresh("s1.old").Return(&session.Session{ID: "s1", UserID: 3, RefreshToken: "s1.new"}, nil)
+	st.EXPECT().GetByID(int64(3)).Return(&user.User{ID: 3, Login: "arin0"}, nil)
+	w := httptest.NewRecorder()
+	service.Refresh(w, httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(`{"refresh_token": "s1.old"}`)))
+	body := struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(w.Result().Body).Decode(&body); err != nil || w.Code != 200 {
+		t.Fatalf("expected tokens, got %d: %v", w.Code, err)
+	}
+	if body.RefreshToken != "s1.new" || body.ExpiresIn != 60 {
+		t.Errorf("unexpected body %+v", body)
+	}
+	claims, err := token.Parse(service.TokenSecret, "Bearer "+body.Token)
+	if err != nil || claims.SessionID != "s1" || claims.User.Login != "arin0" {
+		t.Errorf("bad access token %+v: %v", claims, err)
+	}
+
+	sess.EXPECT().Refresh("s1.old").Return(nil, session.ErrRefreshReused)
+	w = httptest.NewRecorder()
+	service.Refresh(w, httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(`{"refresh_token": "s1.old"}`)))
+	if w.Code != 401 {
+		t.Errorf("expected resp status 401, got %d", w.Code)
+	}
+
+	// the user was deleted after the session was made
+	sess.EXPECT().Refresh("s2.old").Return(&session.Session{ID: "s2", UserID: 9}, nil)
+	st.EXPECT().GetByID(int64(9)).Return(nil, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Refresh(w, httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(`{"refresh_token": "s2.old"}`)))
+	if w.Code != 401 {
+		t.Errorf("expected resp status 401, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	service.Refresh(w, httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(`{}`)))
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+	}
+}
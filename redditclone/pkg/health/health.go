@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a single dependency ping.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK       = "ok"
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+	StatusDraining = "draining"
+)
+
+// Check is a dependency the server needs. When a critical one is down the
+// server is not ready, the others only degrade the report.
+type Check struct {
+	Name     string
+	Critical bool
+	Ping     func(ctx context.Context) error
+}
+
+type Result struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Handler serves the liveness and readiness endpoints. Draining tells that
+// the server is shutting down, it may be nil.
+type Handler struct {
+	Checks   []Check
+	Timeout  time.Duration
+	Draining func() bool
+	Logger   *zap.SugaredLogger
+}
+
+func (h *Handler) draining() bool {
+	return h.Draining != nil && h.Draining()
+}
+
+// Live answers /healthz: the process is up and serves requests. It does not
+// touch the dependencies and stays up while draining, only Ready tells the
+// server is shutting down.
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	h.write(w, http.StatusOK, &Report{Status: StatusOK})
+}
+
+// Ready answers /readyz: it pings every dependency and answers 503 when a
+// critical one is down or the server is draining.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining() {
+		h.write(w, http.StatusServiceUnavailable, &Report{Status: StatusDraining})
+		return
+	}
+	report := h.Run(r.Context())
+	code := http.StatusOK
+	if report.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	h.write(w, code, report)
+}
+
+// Run pings the dependencies in parallel, each with its own timeout.
+func (h *Handler) Run(ctx context.Context) *Report {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	results := make([]Result, len(h.Checks))
+	wg := &sync.WaitGroup{}
+	for i, c := range h.Checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			err := c.Ping(pingCtx)
+			results[i] = Result{Status: StatusUp, Critical: c.Critical, Latency: time.Since(start).String()}
+			if err != nil {
+				results[i].Status, results[i].Error = StatusDown, err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]Result, len(results))}
+	for i, res := range results {
+		report.Checks[h.Checks[i].Name] = res
+		switch {
+		case res.Status == StatusUp:
+		case res.Critical:
+			report.Status = StatusDown
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (h *Handler) write(w http.ResponseWriter, code int, report *Report) {
+	if report.Status != StatusOK && h.Logger != nil {
+		h.Logger.Infow("not healthy", "report", report)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil && h.Logger != nil {
+		h.Logger.Infow("Error of write", "err", err)
+	}
+}
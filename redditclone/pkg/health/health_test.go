@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func up(ctx context.Context) error { return nil }
+
+func down(ctx context.Context) error { return errors.New("connection refused") }
+
+func hang(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func serve(handler http.HandlerFunc) (int, *Report) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/readyz", nil))
+	report := &Report{}
+	_ = json.Unmarshal(w.Body.Bytes(), report)
+	return w.Code, report
+}
+
+func TestReady(t *testing.T) {
+	cases := []struct {
+		name   string
+		checks []Check
+		code   int
+		status string
+	}{
+		{"all up", []Check{{"mysql", true, up}, {"mongo", true, up}}, 200, StatusOK},
+		{"critical down", []Check{{"mysql", true, down}, {"mongo", true, up}}, 503, StatusDown},
+		{"critical timeout", []Check{{"mysql", true, up}, {"mongo", true, hang}}, 503, StatusDown},
+		{"optional down", []Check{{"mysql", true, up}, {"cache", false, down}}, 200, StatusDegraded},
+	}
+	for _, c := range cases {
+		h := &Handler{Checks: c.checks, Timeout: 20 * time.Millisecond}
+		code, report := serve(h.Ready)
+		assert.Equal(t, c.code, code, c.name)
+		assert.Equal(t, c.status, report.Status, c.name)
+		assert.Len(t, report.Checks, len(c.checks), c.name)
+	}
+
+	h := &Handler{Checks: []Check{{"mysql", true, up}, {"mongo", true, down}}}
+	_, report := serve(h.Ready)
+	assert.Equal(t, StatusUp, report.Checks["mysql"].Status)
+	assert.Equal(t, StatusDown, report.Checks["mongo"].Status)
+	assert.Equal(t, "connection refused", report.Checks["mongo"].Error)
+}
+
+func TestDraining(t *testing.T) {
+	draining := false
+	h := &Handler{
+		Checks:   []Check{{"mysql", true, up}},
+		Draining: func() bool { return draining },
+	}
+	code, report := serve(h.Live)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, StatusOK, report.Status)
+
+	draining = true
+	code, report = serve(h.Ready)
+	assert.Equal(t, 503, code)
+	assert.Equal(t, StatusDraining, report.Status)
+	// a draining server is still alive, it must not be restarted
+	code, report = serve(h.Live)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, StatusOK, report.Status)
+}
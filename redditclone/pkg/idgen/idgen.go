@@ -0,0 +1,126 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Generator gives out unique IDs for new posts.
+type Generator interface {
+	NewID(ctx context.Context) (string, error)
+}
+
+// ObjectID makes Mongo object IDs in hex, unique without coordination.
+type ObjectID struct{}
+
+func (ObjectID) NewID(ctx context.Context) (string, error) {
+	return primitive.NewObjectID().Hex(), nil
+}
+
+// Sequence counts IDs in memory, it suits a single process that keeps no
+// posts between runs.
+type Sequence struct {
+	last int64
+}
+
+func NewSequence(last int64) *Sequence {
+	return &Sequence{last: last}
+}
+
+func (s *Sequence) NewID(ctx context.Context) (string, error) {
+	return strconv.FormatInt(atomic.AddInt64(&s.last, 1), 10), nil
+}
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	MaxNode      = 1<<nodeBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+)
+
+// snowflakeEpoch is the start of the snowflake clock, 2022-01-01 UTC.
+var snowflakeEpoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var ErrBadNode = errors.New("snowflake node out of range")
+
+// Snowflake makes time ordered 63 bit IDs: milliseconds since the epoch,
+// the node number and a sequence within the millisecond. Every process
+// writing posts needs its own node number.
+type Snowflake struct {
+	mutex    sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+	now      func() time.Time
+}
+
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > MaxNode {
+		return nil, ErrBadNode
+	}
+	return &Snowflake{node: node, now: time.Now}, nil
+}
+
+func (s *Snowflake) NewID(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ms := s.now().Sub(snowflakeEpoch).Milliseconds()
+	if ms < s.lastTime {
+		// the clock went back, keep counting from the last time seen
+		ms = s.lastTime
+	}
+	if ms == s.lastTime {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			ms++
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastTime = ms
+	id := ms<<(nodeBits+sequenceBits) | s.node<<sequenceBits | s.sequence
+	return strconv.FormatInt(id, 10), nil
+}
+
+// Counter keeps the last ID in a Mongo document, so IDs stay short numbers
+// and are never reused across restarts or processes.
+type Counter struct {
+	data *mongo.Collection
+	name string
+}
+
+func NewCounter(db *mongo.Collection, name string) *Counter {
+	return &Counter{data: db, name: name}
+}
+
+// Ensure moves the counter to at least floor, so IDs given out before the
+// counter existed are skipped.
+func (c *Counter) Ensure(ctx context.Context, floor int64) error {
+	_, err := c.data.UpdateOne(ctx, bson.M{"_id": c.name},
+		bson.M{"$max": bson.M{"seq": floor}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (c *Counter) NewID(ctx context.Context) (string, error) {
+	res := struct {
+		Seq int64 `bson:"seq"`
+	}{}
+	err := c.data.FindOneAndUpdate(ctx, bson.M{"_id": c.name},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&res)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(res.Seq, 10), nil
+}
@@ -0,0 +1,64 @@
+package idgen
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func unique(t *testing.T, g Generator, n int) map[string]bool {
+	ids := make(map[string]bool)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := g.NewID(context.Background())
+			assert.NoError(t, err)
+			mutex.Lock()
+			ids[id] = true
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, ids, n)
+	return ids
+}
+
+func TestSequence(t *testing.T) {
+	s := NewSequence(41)
+	id, err := s.NewID(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "42", id)
+	unique(t, s, 1000)
+}
+
+func TestObjectID(t *testing.T) {
+	unique(t, ObjectID{}, 1000)
+}
+
+func TestSnowflake(t *testing.T) {
+	_, err := NewSnowflake(MaxNode + 1)
+	assert.Equal(t, ErrBadNode, err)
+
+	s, err := NewSnowflake(3)
+	assert.NoError(t, err)
+	now := snowflakeEpoch.Add(time.Second)
+	s.now = func() time.Time { return now }
+
+	// more IDs than fit into one millisecond
+	unique(t, s, maxSequence+100)
+
+	a, _ := s.NewID(context.Background())
+	now = now.Add(-time.Minute)
+	b, _ := s.NewID(context.Background())
+	assert.NotEqual(t, a, b)
+
+	other, _ := NewSnowflake(4)
+	other.now = s.now
+	c, _ := other.NewID(context.Background())
+	assert.NotEqual(t, b, c)
+}
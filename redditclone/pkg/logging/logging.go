@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx that carries the request logger.
+func NewContext(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request logger put by middleware.AccessLog, it
+// already has the request id, the client address and the user. Without one
+// fallback is returned.
+func FromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok && logger != nil {
+		return logger
+	}
+	return fallback
+}
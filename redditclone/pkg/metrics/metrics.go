@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "redditclone"
+
+// Metrics holds the collectors of the server. Everything is registered on
+// the registerer given to New, so tests can use their own registry.
+type Metrics struct {
+	HTTPRequests *prometheus.CounterVec
+	HTTPDuration *prometheus.HistogramVec
+	RepoDuration *prometheus.HistogramVec
+	RepoErrors   *prometheus.CounterVec
+	Votes        *prometheus.CounterVec
+	Comments     *prometheus.CounterVec
+}
+
+func New(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+	return &Metrics{
+		HTTPRequests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		HTTPDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		RepoDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repo_operation_duration_seconds",
+			Help:      "Latency of repository operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"repo", "op"}),
+		RepoErrors: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repo_errors_total",
+			Help:      "Repository operations that returned an error.",
+		}, []string{"repo", "op"}),
+		Votes: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "votes_total",
+			Help:      "Accepted votes by kind: up, down or unvote.",
+		}, []string{"vote"}),
+		Comments: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "comments_total",
+			Help:      "Comment changes by action: add, reply, edit or delete.",
+		}, []string{"action"}),
+	}
+}
+
+// ObserveRequest records a served HTTP request.
+func (m *Metrics) ObserveRequest(route, method string, status int, took time.Duration) {
+	code := statusLabel(status)
+	m.HTTPRequests.WithLabelValues(route, method, code).Inc()
+	m.HTTPDuration.WithLabelValues(route, method, code).Observe(took.Seconds())
+}
+
+// observe records a repository call that started at start.
+func (m *Metrics) observe(repo, op string, start time.Time, err error) {
+	m.RepoDuration.WithLabelValues(repo, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.RepoErrors.WithLabelValues(repo, op).Inc()
+	}
+}
+
+func statusLabel(status int) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return strconv.Itoa(status)
+}
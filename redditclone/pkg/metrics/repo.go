@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"net/http"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"time"
+)
+
+// PostRepo records the latency and the errors of every call of the wrapped
+// repo, and counts the accepted votes and comment changes.
+type PostRepo struct {
+	Repo    post.PostRepo
+	Metrics *Metrics
+}
+
+func NewPostRepo(repo post.PostRepo, m *Metrics) *PostRepo {
+	return &PostRepo{Repo: repo, Metrics: m}
+}
+
+func (r *PostRepo) observe(op string, start time.Time, err error) {
+	r.Metrics.observe("post", op, start, err)
+}
+
+func (r *PostRepo) GetAll(page post.Page) (*post.Listing, error) {
+	start := time.Now()
+	res, err := r.Repo.GetAll(page)
+	r.observe("GetAll", start, err)
+	return res, err
+}
+
+func (r *PostRepo) Add(p *post.Post) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.Add(p)
+	r.observe("Add", start, err)
+	return res, err
+}
+
+func (r *PostRepo) Get(id string) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.Get(id)
+	r.observe("Get", start, err)
+	return res, err
+}
+
+func (r *PostRepo) AddView(id string) (int, error) {
+	start := time.Now()
+	res, err := r.Repo.AddView(id)
+	r.observe("AddView", start, err)
+	return res, err
+}
+
+func (r *PostRepo) Update(id string, changes *post.Changes, author *user.User) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.Update(id, changes, author)
+	r.observe("Update", start, err)
+	return res, err
+}
+
+func (r *PostRepo) GetInCategory(c string, page post.Page) (*post.Listing, error) {
+	start := time.Now()
+	res, err := r.Repo.GetInCategory(c, page)
+	r.observe("GetInCategory", start, err)
+	return res, err
+}
+
+func (r *PostRepo) AddComment(id string, text string, author *user.User) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.AddComment(id, text, author)
+	r.observe("AddComment", start, err)
+	if err == nil {
+		r.Metrics.Comments.WithLabelValues("add").Inc()
+	}
+	return res, err
+}
+
+func (r *PostRepo) AddReply(idPost string, idParent int64, text string, author *user.User) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.AddReply(idPost, idParent, text, author)
+	r.observe("AddReply", start, err)
+	if err == nil {
+		r.Metrics.Comments.WithLabelValues("reply").Inc()
+	}
+	return res, err
+}
+
+func (r *PostRepo) EditComment(idPost string, idComment int64, text string, author *user.User) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.EditComment(idPost, idComment, text, author)
+	r.observe("EditComment", start, err)
+	if err == nil {
+		r.Metrics.Comments.WithLabelValues("edit").Inc()
+	}
+	return res, err
+}
+
+func (r *PostRepo) DeleteComment(idPost string, idComment int64) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.DeleteComment(idPost, idComment)
+	r.observe("DeleteComment", start, err)
+	if err == nil {
+		r.Metrics.Comments.WithLabelValues("delete").Inc()
+	}
+	return res, err
+}
+
+func voteLabel(coin int) string {
+	switch {
+	case coin > 0:
+		return "up"
+	case coin < 0:
+		return "down"
+	}
+	return "unvote"
+}
+
+func (r *PostRepo) UpdateVote(vote int, idPost string, author *user.User) (*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.UpdateVote(vote, idPost, author)
+	r.observe("UpdateVote", start, err)
+	if err == nil {
+		r.Metrics.Votes.WithLabelValues(voteLabel(vote)).Inc()
+	}
+	return res, err
+}
+
+func (r *PostRepo) Delete(id string) (bool, error) {
+	start := time.Now()
+	res, err := r.Repo.Delete(id)
+	r.observe("Delete", start, err)
+	return res, err
+}
+
+func (r *PostRepo) GetFromUser(userName string, page post.Page) (*post.Listing, error) {
+	start := time.Now()
+	res, err := r.Repo.GetFromUser(userName, page)
+	r.observe("GetFromUser", start, err)
+	return res, err
+}
+
+func (r *PostRepo) Search(text string, filter post.Filter, limit int64) ([]*post.Post, error) {
+	start := time.Now()
+	res, err := r.Repo.Search(text, filter, limit)
+	r.observe("Search", start, err)
+	return res, err
+}
+
+// UserRepo records the latency and the errors of the wrapped repo. Failed
+// logins are counted as errors of Authorize.
+type UserRepo struct {
+	Repo    user.UserRepo
+	Metrics *Metrics
+}
+
+func NewUserRepo(repo user.UserRepo, m *Metrics) *UserRepo {
+	return &UserRepo{Repo: repo, Metrics: m}
+}
+
+func (r *UserRepo) Authorize(login, pass string) (*user.User, error) {
+	start := time.Now()
+	res, err := r.Repo.Authorize(login, pass)
+	r.Metrics.observe("user", "Authorize", start, err)
+	return res, err
+}
+
+func (r *UserRepo) AddUserInRepo(login, pass string) (*user.User, error) {
+	start := time.Now()
+	res, err := r.Repo.AddUserInRepo(login, pass)
+	r.Metrics.observe("user", "AddUserInRepo", start, err)
+	return res, err
+}
+
+func (r *UserRepo) GetByID(id int64) (*user.User, error) {
+	start := time.Now()
+	res, err := r.Repo.GetByID(id)
+	r.Metrics.observe("user", "GetByID", start, err)
+	return res, err
+}
+
+// SessRepo records the latency and the errors of the wrapped repo.
+type SessRepo struct {
+	Repo    session.SessRepo
+	Metrics *Metrics
+}
+
+func NewSessRepo(repo session.SessRepo, m *Metrics) *SessRepo {
+	return &SessRepo{Repo: repo, Metrics: m}
+}
+
+func (r *SessRepo) Create(w http.ResponseWriter, userID int64, client session.Client) (*session.Session, error) {
+	start := time.Now()
+	res, err := r.Repo.Create(w, userID, client)
+	r.Metrics.observe("session", "Create", start, err)
+	return res, err
+}
+
+func (r *SessRepo) DestroyCurrent(w http.ResponseWriter, req *http.Request) error {
+	start := time.Now()
+	err := r.Repo.DestroyCurrent(w, req)
+	r.Metrics.observe("session", "DestroyCurrent", start, err)
+	return err
+}
+
+func (r *SessRepo) Destroy(id string) error {
+	start := time.Now()
+	err := r.Repo.Destroy(id)
+	r.Metrics.observe("session", "Destroy", start, err)
+	return err
+}
+
+func (r *SessRepo) DestroyAll(userID int64) error {
+	start := time.Now()
+	err := r.Repo.DestroyAll(userID)
+	r.Metrics.observe("session", "DestroyAll", start, err)
+	return err
+}
+
+func (r *SessRepo) List(userID int64) ([]*session.Session, error) {
+	start := time.Now()
+	res, err := r.Repo.List(userID)
+	r.Metrics.observe("session", "List", start, err)
+	return res, err
+}
+
+func (r *SessRepo) Check(req *http.Request) (*session.Session, error) {
+	start := time.Now()
+	res, err := r.Repo.Check(req)
+	r.Metrics.observe("session", "Check", start, err)
+	return res, err
+}
+
+func (r *SessRepo) Get(id string) (*session.Session, error) {
+	start := time.Now()
+	res, err := r.Repo.Get(id)
+	r.Metrics.observe("session", "Get", start, err)
+	return res, err
+}
+
+func (r *SessRepo) Refresh(token string) (*session.Session, error) {
+	start := time.Now()
+	res, err := r.Repo.Refresh(token)
+	r.Metrics.observe("session", "Refresh", start, err)
+	return res, err
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"testing"
+)
+
+func TestPostRepo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := New(prometheus.NewRegistry())
+	inner := post.NewMockPostRepo(ctrl)
+	repo := NewPostRepo(inner, m)
+	author := &user.User{ID: 1, Login: "arin0"}
+
+	inner.EXPECT().Get("1").Return(&post.Post{ID: "1"}, nil)
+	inner.EXPECT().Get("2").Return(nil, errors.New("no post"))
+	res, err := repo.Get("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", res.ID)
+	_, err = repo.Get("2")
+	assert.Error(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(m.RepoDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.RepoErrors.WithLabelValues("post", "Get")))
+
+	inner.EXPECT().UpdateVote(1, "1", author).Return(&post.Post{}, nil)
+	inner.EXPECT().UpdateVote(-1, "1", author).Return(&post.Post{}, nil)
+	inner.EXPECT().UpdateVote(0, "1", author).Return(nil, errors.New("no post"))
+	for _, coin := range []int{1, -1, 0} {
+		_, _ = repo.UpdateVote(coin, "1", author)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Votes.WithLabelValues("up")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Votes.WithLabelValues("down")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.Votes.WithLabelValues("unvote")))
+
+	inner.EXPECT().AddComment("1", "hi", author).Return(&post.Post{}, nil)
+	inner.EXPECT().AddReply("1", int64(0), "hi", author).Return(&post.Post{}, nil)
+	inner.EXPECT().DeleteComment("1", int64(0)).Return(&post.Post{}, nil)
+	_, _ = repo.AddComment("1", "hi", author)
+	_, _ = repo.AddReply("1", 0, "hi", author)
+	_, _ = repo.DeleteComment("1", 0)
+	for _, action := range []string{"add", "reply", "delete"} {
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.Comments.WithLabelValues(action)), action)
+	}
+}
+
+func TestUserAndSessRepo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	m := New(prometheus.NewRegistry())
+	users := user.NewMockUserRepo(ctrl)
+	sessions := session.NewMockSessRepo(ctrl)
+
+	users.EXPECT().Authorize("arin0", "bad").Return(nil, user.ErrBadPass)
+	_, err := NewUserRepo(users, m).Authorize("arin0", "bad")
+	assert.Equal(t, user.ErrBadPass, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.RepoErrors.WithLabelValues("user", "Authorize")))
+
+	w := httptest.NewRecorder()
+	sessions.EXPECT().Create(w, int64(1), session.Client{}).Return(&session.Session{}, nil)
+	_, err = NewSessRepo(sessions, m).Create(w, 1, session.Client{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.RepoErrors.WithLabelValues("session", "Create")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.RepoDuration))
+}
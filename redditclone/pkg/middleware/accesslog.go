@@ -1,20 +1,179 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"redditclone/pkg/logging"
+	"redditclone/pkg/user"
+	"strings"
 	"time"
 )
 
-func AccessLog(logger *zap.SugaredLogger, next http.Handler) http.Handler {
+// RequestIDHeader carries the id that correlates the log lines of a request.
+// An id sent by the client or a proxy is kept when it looks sane.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLen = 128
+
+type requestInfoKey struct{}
+
+type clientIPKey struct{}
+
+// requestInfo is filled by the inner middlewares for the access log line.
+type requestInfo struct {
+	userID *int64
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// ParseTrustedProxies parses the addresses of the proxies whose
+// X-Forwarded-For is believed. Both CIDRs and single IPs are accepted.
+func ParseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("bad trusted proxy %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %q: %w", item, err)
+		}
+		res = append(res, network)
+	}
+	return res, nil
+}
+
+func trustedIP(ip net.IP, trusted []*net.IPNet) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address of the client. X-Forwarded-For is only followed
+// through trusted proxies: the hops are walked from the right and the first
+// address that is not a trusted proxy is the client.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil || !trustedIP(ip, trusted) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		hopIP := net.ParseIP(hop)
+		if hopIP == nil {
+			// the hop was written by the client, the proxy before it is
+			// the last address we know
+			break
+		}
+		addr = hopIP.String()
+		if !trustedIP(hopIP, trusted) {
+			break
+		}
+	}
+	return addr
+}
+
+// RequestClientIP is the client address found by AccessLog, the peer address
+// of the connection without it.
+func RequestClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return ClientIP(r, nil)
+}
+
+// withUser puts the user authenticated by the token into the context, the
+// access log line and the request logger.
+func withUser(ctx context.Context, u *user.User) context.Context {
+	ctx = context.WithValue(ctx, user.UserKey, u)
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		id := u.ID
+		info.userID = &id
+	}
+	if logger := logging.FromContext(ctx, nil); logger != nil {
+		ctx = logging.NewContext(ctx, logger.With("user_id", u.ID))
+	}
+	return ctx
+}
+
+// AccessLog logs every request with its status, size and duration. It gives
+// the request an id and puts a logger with the id and the client address into
+// the context, see logging.FromContext. The client address is taken from
+// X-Forwarded-For only behind the trusted proxies.
+func AccessLog(logger *zap.SugaredLogger, trusted []*net.IPNet, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		logger.Infow("New request",
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		clientIP := ClientIP(r, trusted)
+		reqLogger := logger.With(
+			"request_id", id,
+			"remote_ip", clientIP,
+		)
+		info := &requestInfo{}
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		ctx = context.WithValue(ctx, clientIPKey{}, clientIP)
+		ctx = logging.NewContext(ctx, reqLogger)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		fields := []interface{}{
 			"method", r.Method,
-			//"remote_addr", r.RemoteAddr,
 			"url", r.URL.Path,
+			"status", sw.Status(),
+			"bytes", sw.bytes,
 			"time", time.Since(start),
-		)
+		}
+		if info.userID != nil {
+			fields = append(fields, "user_id", *info.userID)
+		}
+		reqLogger.Infow("New request", fields...)
 	})
 }
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/logging"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name, remote, xff, ip string
+	}{
+		{"direct", "1.2.3.4:5000", "", "1.2.3.4"},
+		{"untrusted peer", "1.2.3.4:5000", "5.6.7.8", "1.2.3.4"},
+		{"trusted proxy", "10.0.0.1:5000", "5.6.7.8", "5.6.7.8"},
+		{"spoofed left hops", "10.0.0.1:5000", "6.6.6.6, 5.6.7.8, 192.168.1.1", "5.6.7.8"},
+		{"only proxies", "10.0.0.1:5000", "10.0.0.2", "10.0.0.2"},
+		{"garbage hop", "10.0.0.1:5000", "5.6.7.8, junk", "10.0.0.1"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		if c.xff != "" {
+			req.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := ClientIP(req, trusted); got != c.ip {
+			t.Errorf("%s: expected %s, got %s", c.name, c.ip, got)
+		}
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("expected error for a bad cidr")
+	}
+}
+
+func TestRequestClientIP(t *testing.T) {
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestClientIP(r)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
+	AccessLog(zap.NewNop().Sugar(), trusted, next).ServeHTTP(httptest.NewRecorder(), req)
+	if got != "5.6.7.8" {
+		t.Errorf("expected the address found by the access log, got %s", got)
+	}
+
+	// without the access log the header is not believed
+	if ip := RequestClientIP(req); ip != "10.0.0.1" {
+		t.Errorf("expected the peer address, got %s", ip)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core).Sugar()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context(), nil).Infow("inside handler")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+	handler := AccessLog(logger, nil, Auth(testSecret, testSessions{}, next))
+
+	req := httptest.NewRequest("POST", "/api/posts", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	req.Header.Set("Authorization", makeToken(t, testSecret, time.Now().Unix()+60))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("expected request id to be propagated, got %q", got)
+	}
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log lines, got %d", len(entries))
+	}
+	inner, access := entries[0].ContextMap(), entries[1].ContextMap()
+	if inner["request_id"] != "abc-123" || inner["user_id"] != int64(3) {
+		t.Errorf("handler logger has no request fields: %v", inner)
+	}
+	expected := map[string]interface{}{
+		"request_id": "abc-123",
+		"remote_ip":  "192.0.2.1",
+		"status":     int64(201),
+		"bytes":      int64(5),
+		"user_id":    int64(3),
+		"method":     "POST",
+		"url":        "/api/posts",
+	}
+	for k, v := range expected {
+		if access[k] != v {
+			t.Errorf("access log %s: expected %v, got %v", k, v, access[k])
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get(RequestIDHeader); len(got) != 32 {
+		t.Errorf("expected a generated request id, got %q", got)
+	}
+}
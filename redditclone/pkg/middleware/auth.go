@@ -1,72 +1,59 @@
 package middleware
 
 import (
-	"encoding/json"
-	"fmt"
-	"github.com/dgrijalva/jwt-go"
-	"io"
-	"log"
+	"go.uber.org/zap"
 	"net/http"
-	"strings"
+	"redditclone/pkg/apierror"
+	"redditclone/pkg/logging"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"redditclone/pkg/user"
 )
 
-func jsonError(w io.Writer, msg string) {
-	resp, errMrsh := json.Marshal(map[string]interface{}{
-		"message": msg,
-	})
-	if errMrsh != nil {
-		log.Println("Error of Marshal", errMrsh)
-	}
-	_, err := w.Write(resp)
-	if err != nil {
-		log.Println("Error of write", err)
-	}
-}
-
-var (
-	ExampleTokenSecret = []byte("супер секретный ключ")
-)
-
-func Auth(next http.Handler) http.Handler {
+// Auth checks the token of the request and puts its user into the request
+// context together with its session. Requests without a token pass through
+// anonymous, routes that need a user are wrapped with RequireAuth. Tokens are
+// checked against secret and are only accepted while their session is in
+// sessions, so destroying the session revokes them before they expire.
+func Auth(secret []byte, sessions session.SessRepo, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		inToken := r.Header.Get("authorization")
 		if inToken == "" {
 			next.ServeHTTP(w, r)
 			return
 		}
-		_, err := GetInfoFromToken(inToken)
-		if err == nil {
-			next.ServeHTTP(w, r)
+		claims, err := token.Parse(secret, inToken)
+		if err != nil {
+			logging.FromContext(r.Context(), zap.S()).Infow("no auth", "err", err)
+			apierror.Write(w, r, apierror.Wrap(err, http.StatusUnauthorized, apierror.CodeUnauthorized, "no auth"))
 			return
 		}
-		fmt.Println(err)
-		fmt.Println("no auth")
-		w.WriteHeader(422)
-		jsonError(w, "no auth")
+		sess, err := sessions.Get(claims.SessionID)
+		if err == nil && sess.UserID != claims.User.ID {
+			err = session.ErrNoAuth
+		}
+		switch err {
+		case nil:
+		case session.ErrNoAuth:
+			logging.FromContext(r.Context(), zap.S()).Infow("no auth", "err", err)
+			apierror.Write(w, r, apierror.Wrap(err, http.StatusUnauthorized, apierror.CodeUnauthorized, "session revoked"))
+			return
+		default:
+			apierror.Write(w, r, err)
+			return
+		}
+		ctx := session.NewContext(r.Context(), sess)
+		next.ServeHTTP(w, r.WithContext(withUser(ctx, claims.User)))
 	})
 }
-func GetInfoFromToken(token string) (map[string]interface{}, error) {
-	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
-		method, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok || method.Alg() != "HS256" {
-			return nil, fmt.Errorf("bad sign method")
-		}
-		return ExampleTokenSecret, nil
-	}
-	token = strings.Split(token, " ")[1]
-	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, hashSecretGetter)
-	if err != nil {
-		log.Println(err.Error())
-		return nil, err
-	}
 
-	user := claims["user"].(map[string]interface{})
-	data := map[string]interface{}{
-		"Login": user["username"].(string),
-		"ID":    user["id"],
-		"iat":   claims["iat"],
-		"exp":   claims["exp"],
-	}
-	return data, err
+// RequireAuth rejects requests that Auth did not find a user for.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := user.UserFromContext(r.Context()); err != nil {
+			apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test secret of the tokens")
+
+// testSessions has the session s1 of the user 3, s2 belongs to the user 4.
+type testSessions struct {
+	session.SessRepo
+	err error
+}
+
+func (s testSessions) Get(id string) (*session.Session, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	switch id {
+	case "s1":
+		return &session.Session{ID: id, UserID: 3}, nil
+	case "s2":
+		return &session.Session{ID: id, UserID: 4}, nil
+	}
+	return nil, session.ErrNoAuth
+}
+
+func makeToken(t *testing.T, secret []byte, exp int64) string {
+	return makeSessionToken(t, secret, "s1", exp)
+}
+
+func makeSessionToken(t *testing.T, secret []byte, sid string, exp int64) string {
+	claims := jwt.MapClaims{
+		"user": map[string]interface{}{
+			"username": "arin0",
+			"id":       3,
+		},
+		"iat": time.Now().Unix(),
+		"exp": exp,
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("cant sign token: %s", err)
+	}
+	return "Bearer " + tokenString
+}
+
+func TestAuth(t *testing.T) {
+	var got *user.User
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = user.UserFromContext(r.Context())
+	})
+	cases := []struct {
+		name   string
+		token  string
+		status int
+		user   *user.User
+	}{
+		{"anonymous", "", 200, nil},
+		{"valid", makeToken(t, testSecret, time.Now().Unix()+60), 200, &user.User{ID: 3, Login: "arin0"}},
+		{"expired", makeToken(t, testSecret, time.Now().Unix()-60), 401, nil},
+		{"foreign secret", makeToken(t, []byte("other"), time.Now().Unix()+60), 401, nil},
+		{"no bearer", "garbage", 401, nil},
+		{"no session", makeSessionToken(t, testSecret, "", time.Now().Unix()+60), 401, nil},
+		{"destroyed session", makeSessionToken(t, testSecret, "gone", time.Now().Unix()+60), 401, nil},
+		{"session of another user", makeSessionToken(t, testSecret, "s2", time.Now().Unix()+60), 401, nil},
+	}
+	for _, c := range cases {
+		got = nil
+		req := httptest.NewRequest("GET", "/api/posts/", nil)
+		if c.token != "" {
+			req.Header.Add("Authorization", c.token)
+		}
+		w := httptest.NewRecorder()
+		Auth(testSecret, testSessions{}, next).ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.status, w.Code)
+		}
+		if c.user == nil && got != nil || c.user != nil && (got == nil || *got != *c.user) {
+			t.Errorf("%s: expected user %v, got %v", c.name, c.user, got)
+		}
+	}
+}
+
+func TestAuthSession(t *testing.T) {
+	var got *session.Session
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = session.SessionFromContext(r.Context())
+	})
+	req := httptest.NewRequest("POST", "/api/logout", nil)
+	req.Header.Add("Authorization", makeToken(t, testSecret, time.Now().Unix()+60))
+	Auth(testSecret, testSessions{}, next).ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil || got.ID != "s1" {
+		t.Errorf("expected the session of the token, got %v", got)
+	}
+}
+
+func TestAuthSessionsDown(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("next must not be called")
+	})
+	req := httptest.NewRequest("GET", "/api/posts/", nil)
+	req.Header.Add("Authorization", makeToken(t, testSecret, time.Now().Unix()+60))
+	w := httptest.NewRecorder()
+	Auth(testSecret, testSessions{err: fmt.Errorf("connection refused")}, next).ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	handler := Auth(testSecret, testSessions{}, RequireAuth(next))
+
+	req := httptest.NewRequest("POST", "/api/posts", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || called {
+		t.Errorf("expected 401 without calling next, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/posts", nil)
+	req.Header.Add("Authorization", makeToken(t, testSecret, time.Now().Unix()+60))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !called {
+		t.Errorf("expected next to be called, got %d", w.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/metrics"
+	"time"
+)
+
+// UnmatchedRoute labels the requests no route of the router matches, so that
+// random paths do not create new series.
+const UnmatchedRoute = "unmatched"
+
+// routeTemplate is the path template of the route of router that matches r.
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	match := &mux.RouteMatch{}
+	if !router.Match(r, match) || match.Route == nil {
+		return UnmatchedRoute
+	}
+	tpl, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return UnmatchedRoute
+	}
+	return tpl
+}
+
+// Metrics records the count and the latency of the requests by the template
+// of the matched route of router and the status code.
+func Metrics(m *metrics.Metrics, router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeTemplate(router, r)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		m.ObserveRequest(route, r.Method, sw.Status(), time.Since(start))
+	})
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/metrics"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	r := mux.NewRouter()
+	r.HandleFunc("/api/post/{POST_ID}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["POST_ID"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}).Methods("GET")
+	handler := Metrics(m, r, r)
+
+	for _, path := range []string{"/api/post/1", "/api/post/2", "/api/post/missing", "/no/such/page"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	cases := []struct {
+		route, status string
+		count         float64
+	}{
+		{"/api/post/{POST_ID}", "200", 2},
+		{"/api/post/{POST_ID}", "404", 1},
+		{UnmatchedRoute, "404", 1},
+	}
+	for _, c := range cases {
+		got := testutil.ToFloat64(m.HTTPRequests.WithLabelValues(c.route, "GET", c.status))
+		if got != c.count {
+			t.Errorf("%s %s: expected %v requests, got %v", c.route, c.status, c.count, got)
+		}
+	}
+	if n := testutil.CollectAndCount(m.HTTPDuration); n != 3 {
+		t.Errorf("expected 3 latency series, got %d", n)
+	}
+}
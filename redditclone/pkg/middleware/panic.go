@@ -3,14 +3,14 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"redditclone/pkg/apierror"
 )
 
 func Panic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				fmt.Println("recovered", err)
-				http.Error(w, "Internal server error", 500)
+				apierror.Write(w, r, fmt.Errorf("recovered panic: %v", err))
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -0,0 +1,180 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Algorithm names the hash of newly stored passwords.
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+var (
+	ErrMalformed  = errors.New("malformed password hash")
+	ErrBadAlgo    = errors.New("unknown password hash algorithm")
+	ErrMismatched = errors.New("password does not match")
+)
+
+// Argon2Params are the costs of an argon2id hash, they are stored in the hash
+// string so they can be raised without breaking old hashes.
+type Argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// Hasher hashes passwords with one algorithm and verifies hashes of every
+// supported one. Hashes are strings in the modular crypt format:
+//
+//	$2a$10$<bcrypt salt and hash>
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+//
+// The algorithm identifier and the version come first, so hashes made with
+// other settings are recognised and upgraded. Rows that predate hashing hold
+// unsalted MD5 hex digests or plain text, Verify accepts them and asks to
+// rehash.
+type Hasher struct {
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// Default hashes with argon2id at the parameters recommended by RFC 9106 for
+// memory constrained servers.
+var Default = &Hasher{
+	Algorithm:  Argon2id,
+	BcryptCost: bcrypt.DefaultCost,
+	Argon2: Argon2Params{
+		Memory:  64 * 1024,
+		Time:    1,
+		Threads: 4,
+		SaltLen: 16,
+		KeyLen:  32,
+	},
+}
+
+func (h *Hasher) orDefault() *Hasher {
+	if h == nil {
+		return Default
+	}
+	return h
+}
+
+func (h *Hasher) Hash(pass string) (string, error) {
+	h = h.orDefault()
+	switch h.Algorithm {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(pass), h.BcryptCost)
+		return string(hash), err
+	case Argon2id:
+		p := h.Argon2
+		salt := make([]byte, p.SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(pass), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Time, p.Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	}
+	return "", ErrBadAlgo
+}
+
+// Verify checks pass against the stored hash. It returns ErrMismatched for a
+// wrong password. rehash tells that the hash is legacy or made with other
+// settings than the hasher's and should be replaced by Hash(pass).
+func (h *Hasher) Verify(hash, pass string) (rehash bool, err error) {
+	h = h.orDefault()
+	switch {
+	case strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, ErrMismatched
+		}
+		if err != nil {
+			return false, ErrMalformed
+		}
+		cost, _ := bcrypt.Cost([]byte(hash))
+		return h.Algorithm != Bcrypt || cost != h.BcryptCost, nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p, salt, key, err := parseArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(pass), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, ErrMismatched
+		}
+		return h.Algorithm != Argon2id || p != h.Argon2, nil
+	case strings.HasPrefix(hash, "$"):
+		return false, ErrBadAlgo
+	}
+	// an md5 hash is never compared as plain text, the hash itself would
+	// pass for the password
+	if isMD5(hash) {
+		if equal(hash, fmt.Sprintf("%x", md5.Sum([]byte(pass)))) {
+			return true, nil
+		}
+		return false, ErrMismatched
+	}
+	if equal(hash, pass) {
+		return true, nil
+	}
+	return false, ErrMismatched
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func isMD5(hash string) bool {
+	if len(hash) != 32 {
+		return false
+	}
+	for _, r := range hash {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	p := Argon2Params{}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrMalformed
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrMalformed
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrMalformed
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrMalformed
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrMalformed
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
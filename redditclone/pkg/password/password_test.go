@@ -0,0 +1,80 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// fast keeps the costs low so the tests run quickly.
+var fast = &Hasher{
+	Algorithm:  Argon2id,
+	BcryptCost: bcrypt.MinCost,
+	Argon2:     Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+}
+
+func TestArgon2id(t *testing.T) {
+	hash, err := fast.Hash("asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	other, err := fast.Hash("asdfghjk")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes must be salted")
+
+	rehash, err := fast.Verify(hash, "asdfghjk")
+	assert.NoError(t, err)
+	assert.False(t, rehash)
+
+	_, err = fast.Verify(hash, "lol")
+	assert.Equal(t, ErrMismatched, err)
+
+	stronger := *fast
+	stronger.Argon2.Time = 2
+	rehash, err = stronger.Verify(hash, "asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, rehash)
+
+	_, err = fast.Verify("$argon2id$v=19$m=64$bad", "asdfghjk")
+	assert.Equal(t, ErrMalformed, err)
+}
+
+func TestBcrypt(t *testing.T) {
+	h := *fast
+	h.Algorithm = Bcrypt
+	hash, err := h.Hash("asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"))
+
+	rehash, err := h.Verify(hash, "asdfghjk")
+	assert.NoError(t, err)
+	assert.False(t, rehash)
+	_, err = h.Verify(hash, "lol")
+	assert.Equal(t, ErrMismatched, err)
+
+	// switching to argon2id upgrades bcrypt hashes
+	rehash, err = fast.Verify(hash, "asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, rehash)
+}
+
+func TestLegacy(t *testing.T) {
+	// md5 of "asdfghjk" as the old memory repo stored it
+	rehash, err := fast.Verify("bf709005906087dc1256bb4449d8774d", "asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, rehash)
+
+	// whoever learns the stored md5 can not log in with it
+	_, err = fast.Verify("bf709005906087dc1256bb4449d8774d", "bf709005906087dc1256bb4449d8774d")
+	assert.Equal(t, ErrMismatched, err)
+
+	rehash, err = fast.Verify("asdfghjk", "asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, rehash)
+
+	_, err = fast.Verify("asdfghjk", "lol")
+	assert.Equal(t, ErrMismatched, err)
+	_, err = fast.Verify("$6$unknown", "asdfghjk")
+	assert.Equal(t, ErrBadAlgo, err)
+}
@@ -3,6 +3,7 @@ package post
 import (
 	"context"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/ranking"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
 )
@@ -13,6 +14,7 @@ type Post struct {
 	Category         string            `json:"category" bson:"category"`
 	Comments         []comment.Comment `json:"comments" bson:"comments" `
 	Created          string            `json:"created" bson:"created"`
+	Updated          string            `json:"updated,omitempty" bson:"updated,omitempty"`
 	ID               string            `json:"id" bson:"id"`
 	Score            int               `json:"score" bson:"score"`
 	Text             string            `json:"text,omitempty" bson:"text"`
@@ -22,28 +24,78 @@ type Post struct {
 	UpvotePercentage int               `json:"upvotePercentage" bson:"upvotePercentage"`
 	Views            int               `json:"views" bson:"views"`
 	Votes            []vote.Vote       `json:"votes" bson:"votes"`
+	Ups              int               `json:"-" bson:"ups"`
+	Downs            int               `json:"-" bson:"downs"`
+	LastCommentID    int64             `json:"-" bson:"lastCommentID"`
+	Hot              float64           `json:"-" bson:"hot"`
+	Controversy      float64           `json:"-" bson:"controversy"`
+}
+
+// Changes holds the fields of a post its author may edit, nil fields are left
+// as they are.
+type Changes struct {
+	Title *string `json:"title"`
+	Text  *string `json:"text"`
+	URL   *string `json:"url"`
+}
+
+// Empty tells whether the changes leave the post as it is.
+func (c *Changes) Empty() bool {
+	return c.Title == nil && c.Text == nil && c.URL == nil
+}
+
+// Filter selects the posts of a listing, empty fields match everything.
+type Filter struct {
+	Category string
+	AuthorID string
+}
+
+// Page is the part of a listing a client asks for: Limit posts after the post
+// with ID After in the Sort order, Limit 0 means no limit. Period limits the
+// top and controversial listings to recent posts.
+type Page struct {
+	Limit  int64
+	After  string
+	Sort   ranking.Sort
+	Period ranking.Period
+}
+
+// Listing is a page of posts, Next is the After of the following page and is
+// empty on the last one.
+type Listing struct {
+	Posts []*Post `json:"posts"`
+	Next  string  `json:"next,omitempty"`
 }
 
 type PostDataFunctional interface {
 	Len() int64
 	Add(c *Post) (*Post, error)
 	Get(id string) (*Post, error)
-	GetFilter(ctx context.Context, filter interface{}) ([]*Post, error)
-	AddComm(post *Post) (*Post, error)
-	DeleteComm(post *Post) (*Post, error)
-	UpVote(ans *Post) (*Post, error)
+	IncViews(id string) (int, error)
+	Update(post *Post) (*Post, error)
+	Find(ctx context.Context, filter Filter, page Page) ([]*Post, error)
+	Search(ctx context.Context, text string, filter Filter, limit int64) ([]*Post, error)
+	AddComm(id string, c *comment.Comment) (*Post, error)
+	EditComm(id string, idComment int64, text string, author *user.User) (*Post, error)
+	DeleteComm(id string, idComment int64) (*Post, error)
+	Vote(id string, userID int64, coin int) (*Post, error)
 	Delete(id string) (bool, error)
 }
 
 //go:generate mockgen -source=post.go -destination=repo_mock.go -package=post PostRepo
 type PostRepo interface {
-	GetAll() ([]*Post, error)
+	GetAll(page Page) (*Listing, error)
 	Add(*Post) (*Post, error)
 	Get(i string) (*Post, error)
-	GetInCategory(c string) ([]*Post, error)
+	AddView(id string) (int, error)
+	Update(id string, changes *Changes, author *user.User) (*Post, error)
+	GetInCategory(c string, page Page) (*Listing, error)
 	AddComment(id string, text string, author *user.User) (*Post, error)
+	AddReply(idPost string, idParent int64, text string, author *user.User) (*Post, error)
+	EditComment(idPost string, idComment int64, text string, author *user.User) (*Post, error)
 	DeleteComment(idPost string, idComment int64) (*Post, error)
 	UpdateVote(vote int, idPost string, author *user.User) (*Post, error)
 	Delete(id string) (bool, error)
-	GetFromUser(userName string) ([]*Post, error)
+	GetFromUser(userName string, page Page) (*Listing, error)
+	Search(text string, filter Filter, limit int64) ([]*Post, error)
 }
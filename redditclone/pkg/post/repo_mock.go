@@ -5,12 +5,216 @@
 package post
 
 import (
+	context "context"
+	comment "redditclone/pkg/comment"
+	user "redditclone/pkg/user"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
-	user "redditclone/pkg/user"
 )
 
+// MockPostDataFunctional is a mock of PostDataFunctional interface.
+type MockPostDataFunctional struct {
+	ctrl     *gomock.Controller
+	recorder *MockPostDataFunctionalMockRecorder
+}
+
+// MockPostDataFunctionalMockRecorder is the mock recorder for MockPostDataFunctional.
+type MockPostDataFunctionalMockRecorder struct {
+	mock *MockPostDataFunctional
+}
+
+// NewMockPostDataFunctional creates a new mock instance.
+func NewMockPostDataFunctional(ctrl *gomock.Controller) *MockPostDataFunctional {
+	mock := &MockPostDataFunctional{ctrl: ctrl}
+	mock.recorder = &MockPostDataFunctionalMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPostDataFunctional) EXPECT() *MockPostDataFunctionalMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockPostDataFunctional) Add(c *Post) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", c)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockPostDataFunctionalMockRecorder) Add(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockPostDataFunctional)(nil).Add), c)
+}
+
+// AddComm mocks base method.
+func (m *MockPostDataFunctional) AddComm(id string, c *comment.Comment) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddComm", id, c)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddComm indicates an expected call of AddComm.
+func (mr *MockPostDataFunctionalMockRecorder) AddComm(id, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComm", reflect.TypeOf((*MockPostDataFunctional)(nil).AddComm), id, c)
+}
+
+// Delete mocks base method.
+func (m *MockPostDataFunctional) Delete(id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPostDataFunctionalMockRecorder) Delete(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPostDataFunctional)(nil).Delete), id)
+}
+
+// DeleteComm mocks base method.
+func (m *MockPostDataFunctional) DeleteComm(id string, idComment int64) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteComm", id, idComment)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteComm indicates an expected call of DeleteComm.
+func (mr *MockPostDataFunctionalMockRecorder) DeleteComm(id, idComment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComm", reflect.TypeOf((*MockPostDataFunctional)(nil).DeleteComm), id, idComment)
+}
+
+// EditComm mocks base method.
+func (m *MockPostDataFunctional) EditComm(id string, idComment int64, text string, author *user.User) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditComm", id, idComment, text, author)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EditComm indicates an expected call of EditComm.
+func (mr *MockPostDataFunctionalMockRecorder) EditComm(id, idComment, text, author interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditComm", reflect.TypeOf((*MockPostDataFunctional)(nil).EditComm), id, idComment, text, author)
+}
+
+// Find mocks base method.
+func (m *MockPostDataFunctional) Find(ctx context.Context, filter Filter, page Page) ([]*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", ctx, filter, page)
+	ret0, _ := ret[0].([]*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find.
+func (mr *MockPostDataFunctionalMockRecorder) Find(ctx, filter, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockPostDataFunctional)(nil).Find), ctx, filter, page)
+}
+
+// Get mocks base method.
+func (m *MockPostDataFunctional) Get(id string) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", id)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockPostDataFunctionalMockRecorder) Get(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockPostDataFunctional)(nil).Get), id)
+}
+
+// IncViews mocks base method.
+func (m *MockPostDataFunctional) IncViews(id string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncViews", id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncViews indicates an expected call of IncViews.
+func (mr *MockPostDataFunctionalMockRecorder) IncViews(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncViews", reflect.TypeOf((*MockPostDataFunctional)(nil).IncViews), id)
+}
+
+// Len mocks base method.
+func (m *MockPostDataFunctional) Len() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Len")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// Len indicates an expected call of Len.
+func (mr *MockPostDataFunctionalMockRecorder) Len() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockPostDataFunctional)(nil).Len))
+}
+
+// Search mocks base method.
+func (m *MockPostDataFunctional) Search(ctx context.Context, text string, filter Filter, limit int64) ([]*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, text, filter, limit)
+	ret0, _ := ret[0].([]*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockPostDataFunctionalMockRecorder) Search(ctx, text, filter, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockPostDataFunctional)(nil).Search), ctx, text, filter, limit)
+}
+
+// Update mocks base method.
+func (m *MockPostDataFunctional) Update(post *Post) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", post)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPostDataFunctionalMockRecorder) Update(post interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPostDataFunctional)(nil).Update), post)
+}
+
+// Vote mocks base method.
+func (m *MockPostDataFunctional) Vote(id string, userID int64, coin int) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Vote", id, userID, coin)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Vote indicates an expected call of Vote.
+func (mr *MockPostDataFunctionalMockRecorder) Vote(id, userID, coin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Vote", reflect.TypeOf((*MockPostDataFunctional)(nil).Vote), id, userID, coin)
+}
+
 // MockPostRepo is a mock of PostRepo interface.
 type MockPostRepo struct {
 	ctrl     *gomock.Controller
@@ -64,6 +268,36 @@ func (mr *MockPostRepoMockRecorder) AddComment(id, text, author interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockPostRepo)(nil).AddComment), id, text, author)
 }
 
+// AddReply mocks base method.
+func (m *MockPostRepo) AddReply(idPost string, idParent int64, text string, author *user.User) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReply", idPost, idParent, text, author)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddReply indicates an expected call of AddReply.
+func (mr *MockPostRepoMockRecorder) AddReply(idPost, idParent, text, author interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReply", reflect.TypeOf((*MockPostRepo)(nil).AddReply), idPost, idParent, text, author)
+}
+
+// AddView mocks base method.
+func (m *MockPostRepo) AddView(id string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddView", id)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddView indicates an expected call of AddView.
+func (mr *MockPostRepoMockRecorder) AddView(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddView", reflect.TypeOf((*MockPostRepo)(nil).AddView), id)
+}
+
 // Delete mocks base method.
 func (m *MockPostRepo) Delete(id string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +328,21 @@ func (mr *MockPostRepoMockRecorder) DeleteComment(idPost, idComment interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostRepo)(nil).DeleteComment), idPost, idComment)
 }
 
+// EditComment mocks base method.
+func (m *MockPostRepo) EditComment(idPost string, idComment int64, text string, author *user.User) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditComment", idPost, idComment, text, author)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EditComment indicates an expected call of EditComment.
+func (mr *MockPostRepoMockRecorder) EditComment(idPost, idComment, text, author interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditComment", reflect.TypeOf((*MockPostRepo)(nil).EditComment), idPost, idComment, text, author)
+}
+
 // Get mocks base method.
 func (m *MockPostRepo) Get(i string) (*Post, error) {
 	m.ctrl.T.Helper()
@@ -110,48 +359,78 @@ func (mr *MockPostRepoMockRecorder) Get(i interface{}) *gomock.Call {
 }
 
 // GetAll mocks base method.
-func (m *MockPostRepo) GetAll() ([]*Post, error) {
+func (m *MockPostRepo) GetAll(page Page) (*Listing, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAll")
-	ret0, _ := ret[0].([]*Post)
+	ret := m.ctrl.Call(m, "GetAll", page)
+	ret0, _ := ret[0].(*Listing)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAll indicates an expected call of GetAll.
-func (mr *MockPostRepoMockRecorder) GetAll() *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetAll(page interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockPostRepo)(nil).GetAll))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockPostRepo)(nil).GetAll), page)
 }
 
 // GetFromUser mocks base method.
-func (m *MockPostRepo) GetFromUser(userName string) ([]*Post, error) {
+func (m *MockPostRepo) GetFromUser(userName string, page Page) (*Listing, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFromUser", userName)
-	ret0, _ := ret[0].([]*Post)
+	ret := m.ctrl.Call(m, "GetFromUser", userName, page)
+	ret0, _ := ret[0].(*Listing)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetFromUser indicates an expected call of GetFromUser.
-func (mr *MockPostRepoMockRecorder) GetFromUser(userName interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetFromUser(userName, page interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFromUser", reflect.TypeOf((*MockPostRepo)(nil).GetFromUser), userName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFromUser", reflect.TypeOf((*MockPostRepo)(nil).GetFromUser), userName, page)
 }
 
 // GetInCategory mocks base method.
-func (m *MockPostRepo) GetInCategory(c string) ([]*Post, error) {
+func (m *MockPostRepo) GetInCategory(c string, page Page) (*Listing, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInCategory", c)
-	ret0, _ := ret[0].([]*Post)
+	ret := m.ctrl.Call(m, "GetInCategory", c, page)
+	ret0, _ := ret[0].(*Listing)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetInCategory indicates an expected call of GetInCategory.
-func (mr *MockPostRepoMockRecorder) GetInCategory(c interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetInCategory(c, page interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInCategory", reflect.TypeOf((*MockPostRepo)(nil).GetInCategory), c, page)
+}
+
+// Search mocks base method.
+func (m *MockPostRepo) Search(text string, filter Filter, limit int64) ([]*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", text, filter, limit)
+	ret0, _ := ret[0].([]*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockPostRepoMockRecorder) Search(text, filter, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockPostRepo)(nil).Search), text, filter, limit)
+}
+
+// Update mocks base method.
+func (m *MockPostRepo) Update(id string, changes *Changes, author *user.User) (*Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", id, changes, author)
+	ret0, _ := ret[0].(*Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPostRepoMockRecorder) Update(id, changes, author interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInCategory", reflect.TypeOf((*MockPostRepo)(nil).GetInCategory), c)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPostRepo)(nil).Update), id, changes, author)
 }
 
 // UpdateVote mocks base method.
@@ -0,0 +1,97 @@
+package ranking
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Sort is the order of a post feed.
+type Sort string
+
+const (
+	Hot           Sort = "hot"
+	New           Sort = "new"
+	Top           Sort = "top"
+	Controversial Sort = "controversial"
+)
+
+// Period is the time window of the top and controversial feeds.
+type Period string
+
+const (
+	Day   Period = "day"
+	Week  Period = "week"
+	Month Period = "month"
+	All   Period = "all"
+)
+
+var (
+	ErrBadSort   = errors.New("unknown sort")
+	ErrBadPeriod = errors.New("unknown period")
+)
+
+// Epoch is the start of the hot scale, 2005-12-08 07:46:43 UTC as on Reddit.
+const Epoch = 1134028003
+
+func ParseSort(s string) (Sort, error) {
+	switch Sort(s) {
+	case Hot, New, Top, Controversial:
+		return Sort(s), nil
+	case "":
+		return Top, nil
+	}
+	return "", ErrBadSort
+}
+
+func ParsePeriod(s string) (Period, error) {
+	switch Period(s) {
+	case Day, Week, Month, All:
+		return Period(s), nil
+	case "":
+		return All, nil
+	}
+	return "", ErrBadPeriod
+}
+
+// Since returns the oldest creation time that still falls into the period,
+// the zero time for All.
+func (p Period) Since(now time.Time) time.Time {
+	switch p {
+	case Day:
+		return now.AddDate(0, 0, -1)
+	case Week:
+		return now.AddDate(0, 0, -7)
+	case Month:
+		return now.AddDate(0, -1, 0)
+	}
+	return time.Time{}
+}
+
+// HotScore ranks a post by the order of magnitude of its score with a bonus
+// for freshness: every 12.5 hours weigh as much as ten times the votes.
+func HotScore(score int, created time.Time) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := float64(created.Unix() - Epoch)
+	return math.Round((sign*order+seconds/45000)*1e7) / 1e7
+}
+
+// Controversy is high for posts with many votes split evenly between up and
+// down, and zero when all votes agree.
+func Controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
@@ -0,0 +1,47 @@
+package ranking
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHotScore(t *testing.T) {
+	now := time.Date(2022, 5, 10, 13, 31, 10, 0, time.UTC)
+
+	assert.Greater(t, HotScore(10, now), HotScore(1, now))
+	assert.Greater(t, HotScore(2, now), HotScore(-2, now))
+	assert.Equal(t, HotScore(0, now), HotScore(1, now))
+	// a day old post needs far more votes to stay ahead of a fresh one
+	assert.Greater(t, HotScore(1, now), HotScore(50, now.Add(-24*time.Hour)))
+	assert.Less(t, HotScore(1, now), HotScore(1000, now.Add(-24*time.Hour)))
+}
+
+func TestControversy(t *testing.T) {
+	assert.Equal(t, 0.0, Controversy(10, 0))
+	assert.Equal(t, 0.0, Controversy(0, 10))
+	assert.Equal(t, 20.0, Controversy(10, 10))
+	assert.Greater(t, Controversy(10, 10), Controversy(15, 5))
+	assert.Equal(t, Controversy(15, 5), Controversy(5, 15))
+}
+
+func TestParse(t *testing.T) {
+	s, err := ParseSort("")
+	assert.NoError(t, err)
+	assert.Equal(t, Top, s)
+	s, err = ParseSort("hot")
+	assert.NoError(t, err)
+	assert.Equal(t, Hot, s)
+	_, err = ParseSort("best")
+	assert.Equal(t, ErrBadSort, err)
+
+	p, err := ParsePeriod("")
+	assert.NoError(t, err)
+	assert.Equal(t, All, p)
+	_, err = ParsePeriod("year")
+	assert.Equal(t, ErrBadPeriod, err)
+
+	now := time.Date(2022, 5, 10, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC), Week.Since(now))
+	assert.True(t, All.Since(now).IsZero())
+}
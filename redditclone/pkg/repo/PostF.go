@@ -2,96 +2,186 @@ package repo
 
 import (
 	"context"
-	"go.mongodb.org/mongo-driver/bson"
 	"log"
 	"math"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/idgen"
 	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
-	"strconv"
+	"strings"
 	"time"
 )
 
 type PostDB struct {
-	data      post.PostDataFunctional
-	lastIndex int64
+	data post.PostDataFunctional
+	ids  idgen.Generator
 }
 
-func NewPostDB(db post.PostDataFunctional) *PostDB {
+func NewPostDB(db post.PostDataFunctional, ids idgen.Generator) *PostDB {
 	return &PostDB{data: db,
-		lastIndex: db.Len(),
+		ids: ids,
 	}
 }
 
+// maxIDAttempts bounds the new IDs a post is given while the ones it gets
+// are already taken, e.g. by posts stored before the counter existed.
+const maxIDAttempts = 5
+
 func (m *PostDB) Add(c *post.Post) (*post.Post, error) {
-	c.Created = time.Now().Format(time.RFC3339)
+	now := time.Now().UTC()
+	c.Created = now.Format(time.RFC3339)
 	c.UpvotePercentage = 0
 	c.Views = 0
 	c.Score = 0
 	c.AuthorID = c.Author.Login
 	c.Comments = []comment.Comment{}
+	c.LastCommentID = -1
 	c.Votes = []vote.Vote{}
-	c.ID = strconv.Itoa(int(m.lastIndex + 1))
-	_, err := m.data.Add(c)
-	if err != nil {
-		log.Println("err in Add PostDB:", err)
-		return nil, err
+	c.Hot = ranking.HotScore(0, now)
+	c.Controversy = 0
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		id, err := m.ids.NewID(context.TODO())
+		if err != nil {
+			log.Println("err in new post id:", err)
+			return nil, err
+		}
+		c.ID = id
+		_, err = m.data.Add(c)
+		if err == ErrDuplicateID {
+			continue
+		}
+		if err != nil {
+			log.Println("err in Add PostDB:", err)
+			return nil, err
+		}
+		return c, nil
 	}
-	return c, nil
+	return nil, ErrDuplicateID
 }
 func (m *PostDB) Get(id string) (*post.Post, error) {
 	return m.data.Get(id)
 }
-func (m *PostDB) GetAll() ([]*post.Post, error) {
-	return m.data.GetFilter(context.TODO(), bson.M{})
+
+// AddView counts one more view of the post and returns the new count.
+func (m *PostDB) AddView(id string) (int, error) {
+	return m.data.IncViews(id)
+}
+
+// Update applies the changes of author to the post, empty changes leave it
+// as it is.
+func (m *PostDB) Update(id string, changes *post.Changes, author *user.User) (*post.Post, error) {
+	p, err := m.Get(id)
+	if err != nil {
+		log.Println("err in Update:", err)
+		return nil, err
+	}
+	if p.AuthorID != author.Login {
+		return nil, ErrNotAuthor
+	}
+	if changes.Empty() {
+		return p, nil
+	}
+	if changes.Text != nil && p.Type != "text" || changes.URL != nil && p.Type != "link" {
+		return nil, ErrBadPostType
+	}
+	if changes.Title != nil {
+		p.Title = *changes.Title
+	}
+	if changes.Text != nil {
+		p.Text = *changes.Text
+	}
+	if changes.URL != nil {
+		p.URL = *changes.URL
+	}
+	p.Updated = time.Now().UTC().Format(time.RFC3339)
+	return m.data.Update(p)
+}
+func (m *PostDB) GetAll(page post.Page) (*post.Listing, error) {
+	return m.find(post.Filter{}, page)
 }
-func (m *PostDB) GetInCategory(c string) ([]*post.Post, error) {
-	return m.data.GetFilter(context.TODO(), bson.M{"category": c})
+func (m *PostDB) GetInCategory(c string, page post.Page) (*post.Listing, error) {
+	return m.find(post.Filter{Category: c}, page)
 }
-func (m *PostDB) GetFromUser(userName string) ([]*post.Post, error) {
-	return m.data.GetFilter(context.TODO(), bson.M{"authorID": userName})
+func (m *PostDB) GetFromUser(userName string, page post.Page) (*post.Listing, error) {
+	return m.find(post.Filter{AuthorID: userName}, page)
 }
-func (m *PostDB) AddComment(id string, text string, author *user.User) (*post.Post, error) {
-	post, err := m.Get(id)
+
+// find loads one post more than the page asks for to learn whether there is
+// a next page.
+func (m *PostDB) find(filter post.Filter, page post.Page) (*post.Listing, error) {
+	var err error
+	page.Sort, err = ranking.ParseSort(string(page.Sort))
 	if err != nil {
-		log.Println("err in AddComment:", err)
 		return nil, err
 	}
-	post.Comments, err = comment.Create(post.Comments, text, author)
+	page.Period, err = ranking.ParsePeriod(string(page.Period))
 	if err != nil {
 		return nil, err
 	}
-	return m.data.AddComm(post)
-}
-func (m *PostDB) DeleteComment(idPost string, idComment int64) (*post.Post, error) {
-	post, err := m.Get(idPost)
+	limit := page.Limit
+	if limit > 0 {
+		page.Limit++
+	}
+	posts, err := m.data.Find(context.TODO(), filter, page)
 	if err != nil {
-		log.Println(err, "err in AddComment")
 		return nil, err
 	}
-	post.Comments = comment.Delete(post.Comments, idComment)
-	return m.data.DeleteComm(post)
+	res := &post.Listing{Posts: posts}
+	if limit > 0 && int64(len(posts)) > limit {
+		res.Posts = posts[:limit]
+		res.Next = posts[limit-1].ID
+	}
+	if res.Posts == nil {
+		res.Posts = []*post.Post{}
+	}
+	return res, nil
 }
-func (m *PostDB) UpdateVote(coin int, idPost string, author *user.User) (*post.Post, error) {
-	ans, err := m.Get(idPost)
-	if err != nil {
-		log.Println(err, "err in UpdateVote:", err)
-		return nil, err
+
+// Search returns at most limit posts matching text, the most relevant first.
+func (m *PostDB) Search(text string, filter post.Filter, limit int64) ([]*post.Post, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, ErrEmptyQuery
 	}
-	c, err := vote.MakeVoteArr(ans.Votes, coin, author)
+	posts, err := m.data.Search(context.TODO(), text, filter, limit)
 	if err != nil {
-		log.Println("err in UpdVote, aft makeVote:", err)
 		return nil, err
 	}
-	ans.Votes = c
-	UpdateScore(ans)
-	return m.data.UpVote(ans)
+	if posts == nil {
+		posts = []*post.Post{}
+	}
+	return posts, nil
+}
+func (m *PostDB) AddComment(id string, text string, author *user.User) (*post.Post, error) {
+	return m.data.AddComm(id, comment.New(text, author))
+}
+func (m *PostDB) AddReply(idPost string, idParent int64, text string, author *user.User) (*post.Post, error) {
+	item := comment.New(text, author)
+	item.ParentID = &idParent
+	return m.data.AddComm(idPost, item)
+}
+func (m *PostDB) EditComment(idPost string, idComment int64, text string, author *user.User) (*post.Post, error) {
+	return m.data.EditComm(idPost, idComment, text, author)
+}
+func (m *PostDB) DeleteComment(idPost string, idComment int64) (*post.Post, error) {
+	return m.data.DeleteComm(idPost, idComment)
+}
+
+// UpdateVote applies the vote of author to the post: 1 and -1 vote up and
+// down, voting the same way twice or 0 takes the vote back.
+func (m *PostDB) UpdateVote(coin int, idPost string, author *user.User) (*post.Post, error) {
+	if coin != 1 && coin != 0 && coin != -1 {
+		return nil, vote.ErrBadVote
+	}
+	return m.data.Vote(idPost, author.ID, coin)
 }
 func (m *PostDB) Delete(id string) (bool, error) {
 	return m.data.Delete(id)
 }
 
+// UpdateScore recounts the score of the post from its votes together with the
+// ranks the listings are sorted by.
 func UpdateScore(post *post.Post) {
 	score := 0
 	upvotes := 0
@@ -103,6 +193,13 @@ func UpdateScore(post *post.Post) {
 		}
 	}
 	post.Score = score
+	post.Ups, post.Downs = upvotes, votes-upvotes
+	post.Controversy = ranking.Controversy(upvotes, votes-upvotes)
+	created, err := time.Parse(time.RFC3339, post.Created)
+	if err != nil {
+		log.Println("err in parse created of post", post.ID, err)
+	}
+	post.Hot = ranking.HotScore(score, created)
 	if votes == 0 {
 		post.UpvotePercentage = 0
 		return
@@ -4,7 +4,9 @@ package mocks
 
 import (
 	context "context"
-	"gitlab.com/mailru-go/lectures-2022-1/06_databases/99_hw/redditclone/pkg/post"
+	comment "redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	user "redditclone/pkg/user"
 )
 import mock "github.com/stretchr/testify/mock"
 
@@ -36,13 +38,13 @@ func (_m *PostDataFunctional) Add(c *post.Post) (*post.Post, error) {
 	return r0, r1
 }
 
-// AddComm provides a mock function with given fields: _a0
-func (_m *PostDataFunctional) AddComm(_a0 *post.Post) (*post.Post, error) {
-	ret := _m.Called(_a0)
+// AddComm provides a mock function with given fields: id, c
+func (_m *PostDataFunctional) AddComm(id string, c *comment.Comment) (*post.Post, error) {
+	ret := _m.Called(id, c)
 
 	var r0 *post.Post
-	if rf, ok := ret.Get(0).(func(*post.Post) *post.Post); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(string, *comment.Comment) *post.Post); ok {
+		r0 = rf(id, c)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*post.Post)
@@ -50,8 +52,8 @@ func (_m *PostDataFunctional) AddComm(_a0 *post.Post) (*post.Post, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*post.Post) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(string, *comment.Comment) error); ok {
+		r1 = rf(id, c)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -80,13 +82,13 @@ func (_m *PostDataFunctional) Delete(id string) (bool, error) {
 	return r0, r1
 }
 
-// DeleteComm provides a mock function with given fields: _a0
-func (_m *PostDataFunctional) DeleteComm(_a0 *post.Post) (*post.Post, error) {
-	ret := _m.Called(_a0)
+// DeleteComm provides a mock function with given fields: id, idComment
+func (_m *PostDataFunctional) DeleteComm(id string, idComment int64) (*post.Post, error) {
+	ret := _m.Called(id, idComment)
 
 	var r0 *post.Post
-	if rf, ok := ret.Get(0).(func(*post.Post) *post.Post); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(string, int64) *post.Post); ok {
+		r0 = rf(id, idComment)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*post.Post)
@@ -94,8 +96,54 @@ func (_m *PostDataFunctional) DeleteComm(_a0 *post.Post) (*post.Post, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*post.Post) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(string, int64) error); ok {
+		r1 = rf(id, idComment)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EditComm provides a mock function with given fields: id, idComment, text, author
+func (_m *PostDataFunctional) EditComm(id string, idComment int64, text string, author *user.User) (*post.Post, error) {
+	ret := _m.Called(id, idComment, text, author)
+
+	var r0 *post.Post
+	if rf, ok := ret.Get(0).(func(string, int64, string, *user.User) *post.Post); ok {
+		r0 = rf(id, idComment, text, author)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, string, *user.User) error); ok {
+		r1 = rf(id, idComment, text, author)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Find provides a mock function with given fields: ctx, filter, page
+func (_m *PostDataFunctional) Find(ctx context.Context, filter post.Filter, page post.Page) ([]*post.Post, error) {
+	ret := _m.Called(ctx, filter, page)
+
+	var r0 []*post.Post
+	if rf, ok := ret.Get(0).(func(context.Context, post.Filter, post.Page) []*post.Post); ok {
+		r0 = rf(ctx, filter, page)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, post.Filter, post.Page) error); ok {
+		r1 = rf(ctx, filter, page)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -126,22 +174,20 @@ func (_m *PostDataFunctional) Get(id string) (*post.Post, error) {
 	return r0, r1
 }
 
-// GetFilter provides a mock function with given fields: ctx, filter
-func (_m *PostDataFunctional) GetFilter(ctx context.Context, filter interface{}) ([]*post.Post, error) {
-	ret := _m.Called(ctx, filter)
+// IncViews provides a mock function with given fields: id
+func (_m *PostDataFunctional) IncViews(id string) (int, error) {
+	ret := _m.Called(id)
 
-	var r0 []*post.Post
-	if rf, ok := ret.Get(0).(func(context.Context, interface{}) []*post.Post); ok {
-		r0 = rf(ctx, filter)
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string) int); ok {
+		r0 = rf(id)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*post.Post)
-		}
+		r0 = ret.Get(0).(int)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, interface{}) error); ok {
-		r1 = rf(ctx, filter)
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -163,13 +209,36 @@ func (_m *PostDataFunctional) Len() int64 {
 	return r0
 }
 
-// UpVote provides a mock function with given fields: ans
-func (_m *PostDataFunctional) UpVote(ans *post.Post) (*post.Post, error) {
-	ret := _m.Called(ans)
+// Search provides a mock function with given fields: ctx, text, filter, limit
+func (_m *PostDataFunctional) Search(ctx context.Context, text string, filter post.Filter, limit int64) ([]*post.Post, error) {
+	ret := _m.Called(ctx, text, filter, limit)
+
+	var r0 []*post.Post
+	if rf, ok := ret.Get(0).(func(context.Context, string, post.Filter, int64) []*post.Post); ok {
+		r0 = rf(ctx, text, filter, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, post.Filter, int64) error); ok {
+		r1 = rf(ctx, text, filter, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Update provides a mock function with given fields: _a0
+func (_m *PostDataFunctional) Update(_a0 *post.Post) (*post.Post, error) {
+	ret := _m.Called(_a0)
 
 	var r0 *post.Post
 	if rf, ok := ret.Get(0).(func(*post.Post) *post.Post); ok {
-		r0 = rf(ans)
+		r0 = rf(_a0)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*post.Post)
@@ -178,7 +247,30 @@ func (_m *PostDataFunctional) UpVote(ans *post.Post) (*post.Post, error) {
 
 	var r1 error
 	if rf, ok := ret.Get(1).(func(*post.Post) error); ok {
-		r1 = rf(ans)
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Vote provides a mock function with given fields: id, userID, coin
+func (_m *PostDataFunctional) Vote(id string, userID int64, coin int) (*post.Post, error) {
+	ret := _m.Called(id, userID, coin)
+
+	var r0 *post.Post
+	if rf, ok := ret.Get(0).(func(string, int64, int) *post.Post); ok {
+		r0 = rf(id, userID, coin)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, int) error); ok {
+		r1 = rf(id, userID, coin)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -3,8 +3,8 @@
 package mocks
 
 import mock "github.com/stretchr/testify/mock"
-import post "gitlab.com/mailru-go/lectures-2022-1/06_databases/99_hw/redditclone/pkg/post"
-import user "gitlab.com/mailru-go/lectures-2022-1/06_databases/99_hw/redditclone/pkg/user"
+import post "redditclone/pkg/post"
+import user "redditclone/pkg/user"
 
 // PostRepo is an autogenerated mock type for the PostRepo type
 type PostRepo struct {
@@ -57,6 +57,50 @@ func (_m *PostRepo) AddComment(id string, text string, author *user.User) (*post
 	return r0, r1
 }
 
+// AddReply provides a mock function with given fields: idPost, idParent, text, author
+func (_m *PostRepo) AddReply(idPost string, idParent int64, text string, author *user.User) (*post.Post, error) {
+	ret := _m.Called(idPost, idParent, text, author)
+
+	var r0 *post.Post
+	if rf, ok := ret.Get(0).(func(string, int64, string, *user.User) *post.Post); ok {
+		r0 = rf(idPost, idParent, text, author)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, string, *user.User) error); ok {
+		r1 = rf(idPost, idParent, text, author)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddView provides a mock function with given fields: id
+func (_m *PostRepo) AddView(id string) (int, error) {
+	ret := _m.Called(id)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string) int); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: id
 func (_m *PostRepo) Delete(id string) (bool, error) {
 	ret := _m.Called(id)
@@ -101,6 +145,29 @@ func (_m *PostRepo) DeleteComment(idPost string, idComment int64) (*post.Post, e
 	return r0, r1
 }
 
+// EditComment provides a mock function with given fields: idPost, idComment, text, author
+func (_m *PostRepo) EditComment(idPost string, idComment int64, text string, author *user.User) (*post.Post, error) {
+	ret := _m.Called(idPost, idComment, text, author)
+
+	var r0 *post.Post
+	if rf, ok := ret.Get(0).(func(string, int64, string, *user.User) *post.Post); ok {
+		r0 = rf(idPost, idComment, text, author)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, string, *user.User) error); ok {
+		r1 = rf(idPost, idComment, text, author)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Get provides a mock function with given fields: i
 func (_m *PostRepo) Get(i string) (*post.Post, error) {
 	ret := _m.Called(i)
@@ -124,22 +191,22 @@ func (_m *PostRepo) Get(i string) (*post.Post, error) {
 	return r0, r1
 }
 
-// GetAll provides a mock function with given fields:
-func (_m *PostRepo) GetAll() ([]*post.Post, error) {
-	ret := _m.Called()
+// GetAll provides a mock function with given fields: page
+func (_m *PostRepo) GetAll(page post.Page) (*post.Listing, error) {
+	ret := _m.Called(page)
 
-	var r0 []*post.Post
-	if rf, ok := ret.Get(0).(func() []*post.Post); ok {
-		r0 = rf()
+	var r0 *post.Listing
+	if rf, ok := ret.Get(0).(func(post.Page) *post.Listing); ok {
+		r0 = rf(page)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*post.Post)
+			r0 = ret.Get(0).(*post.Listing)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(post.Page) error); ok {
+		r1 = rf(page)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -147,22 +214,45 @@ func (_m *PostRepo) GetAll() ([]*post.Post, error) {
 	return r0, r1
 }
 
-// GetFromUser provides a mock function with given fields: userName
-func (_m *PostRepo) GetFromUser(userName string) ([]*post.Post, error) {
-	ret := _m.Called(userName)
+// GetFromUser provides a mock function with given fields: userName, page
+func (_m *PostRepo) GetFromUser(userName string, page post.Page) (*post.Listing, error) {
+	ret := _m.Called(userName, page)
 
-	var r0 []*post.Post
-	if rf, ok := ret.Get(0).(func(string) []*post.Post); ok {
-		r0 = rf(userName)
+	var r0 *post.Listing
+	if rf, ok := ret.Get(0).(func(string, post.Page) *post.Listing); ok {
+		r0 = rf(userName, page)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]*post.Post)
+			r0 = ret.Get(0).(*post.Listing)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(userName)
+	if rf, ok := ret.Get(1).(func(string, post.Page) error); ok {
+		r1 = rf(userName, page)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetInCategory provides a mock function with given fields: c, page
+func (_m *PostRepo) GetInCategory(c string, page post.Page) (*post.Listing, error) {
+	ret := _m.Called(c, page)
+
+	var r0 *post.Listing
+	if rf, ok := ret.Get(0).(func(string, post.Page) *post.Listing); ok {
+		r0 = rf(c, page)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*post.Listing)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, post.Page) error); ok {
+		r1 = rf(c, page)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -170,13 +260,13 @@ func (_m *PostRepo) GetFromUser(userName string) ([]*post.Post, error) {
 	return r0, r1
 }
 
-// GetInCategory provides a mock function with given fields: c
-func (_m *PostRepo) GetInCategory(c string) ([]*post.Post, error) {
-	ret := _m.Called(c)
+// Search provides a mock function with given fields: text, filter, limit
+func (_m *PostRepo) Search(text string, filter post.Filter, limit int64) ([]*post.Post, error) {
+	ret := _m.Called(text, filter, limit)
 
 	var r0 []*post.Post
-	if rf, ok := ret.Get(0).(func(string) []*post.Post); ok {
-		r0 = rf(c)
+	if rf, ok := ret.Get(0).(func(string, post.Filter, int64) []*post.Post); ok {
+		r0 = rf(text, filter, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*post.Post)
@@ -184,8 +274,31 @@ func (_m *PostRepo) GetInCategory(c string) ([]*post.Post, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(c)
+	if rf, ok := ret.Get(1).(func(string, post.Filter, int64) error); ok {
+		r1 = rf(text, filter, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Update provides a mock function with given fields: id, changes, author
+func (_m *PostRepo) Update(id string, changes *post.Changes, author *user.User) (*post.Post, error) {
+	ret := _m.Called(id, changes, author)
+
+	var r0 *post.Post
+	if rf, ok := ret.Get(0).(func(string, *post.Changes, *user.User) *post.Post); ok {
+		r0 = rf(id, changes, author)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*post.Post)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *post.Changes, *user.User) error); ok {
+		r1 = rf(id, changes, author)
 	} else {
 		r1 = ret.Error(1)
 	}
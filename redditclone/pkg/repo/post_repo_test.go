@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/stretchr/testify/mock"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/idgen"
 	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
 	"redditclone/pkg/repo/mocks"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
 	"testing"
+	"time"
 )
 
 var (
@@ -34,7 +37,7 @@ var (
 		Author:           user.User{ID: 3, Login: "arin0"},
 		AuthorID:         "arin0",
 		Category:         "music",
-		Comments:         []comment.Comment{{postEx.Author, "textCom", "89789", 1}},
+		Comments:         []comment.Comment{{Author: postEx.Author, Body: "textCom", Created: "89789", ID: 1}},
 		Created:          "2022-05-10T13:31:10+03:00",
 		ID:               "2",
 		Score:            1,
@@ -49,7 +52,7 @@ var (
 		Author:           user.User{ID: 3, Login: "arin0"},
 		AuthorID:         "arin0",
 		Category:         "music",
-		Comments:         []comment.Comment{{postEx2.Author, "textCom", "89789", 1}},
+		Comments:         []comment.Comment{{Author: postEx2.Author, Body: "textCom", Created: "89789", ID: 1}},
 		Created:          "2022-05-10T13:31:10+03:00",
 		ID:               "3",
 		Score:            1,
@@ -64,18 +67,16 @@ var (
 
 func TestAdd(t *testing.T) {
 	db := InitMock()
-	db.(*mocks.PostDataFunctional).
-		On("Len").
-		Return(int64(2))
 	db.(*mocks.PostDataFunctional).
 		On("Add", postEx).
 		Return(postEx, nil)
 
-	DB := NewPostDB(db)
+	DB := NewPostDB(db, idgen.NewSequence(0))
 	res, err := DB.Add(postEx)
 
 	assert.NoError(t, err)
 	assert.Equal(t, postEx, res)
+	assert.Equal(t, "1", res.ID)
 	db.(*mocks.PostDataFunctional).
 		On("Add", postEx2).
 		Return(nil, errors.New("mocked-user-db-error"))
@@ -85,12 +86,27 @@ func TestAdd(t *testing.T) {
 	assert.EqualError(t, err0, "mocked-user-db-error")
 }
 
-func InitMock() post.PostDataFunctional {
+func TestAddTakenID(t *testing.T) {
 	db := &mocks.PostDataFunctional{}
-	db.
-		On("Len").
-		Return(int64(2))
-	return db
+	p := &post.Post{Author: user.User{ID: 3, Login: "arin0"}, Type: "text"}
+	db.On("Add", p).Return(nil, ErrDuplicateID).Twice()
+	db.On("Add", p).Return(p, nil).Once()
+
+	// the posts stored before the counter took the first two IDs
+	res, err := NewPostDB(db, idgen.NewSequence(0)).Add(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", res.ID)
+	db.AssertNumberOfCalls(t, "Add", 3)
+
+	db = &mocks.PostDataFunctional{}
+	db.On("Add", mock.Anything).Return(nil, ErrDuplicateID)
+	_, err = NewPostDB(db, idgen.NewSequence(0)).Add(p)
+	assert.Equal(t, ErrDuplicateID, err)
+	db.AssertNumberOfCalls(t, "Add", maxIDAttempts)
+}
+
+func InitMock() post.PostDataFunctional {
+	return &mocks.PostDataFunctional{}
 }
 
 func TestGets(t *testing.T) {
@@ -100,203 +116,305 @@ func TestGets(t *testing.T) {
 		On("Get", id).
 		Return(postEx, nil)
 
-	DB := NewPostDB(db)
+	DB := NewPostDB(db, idgen.NewSequence(0))
 	res, err := DB.Get(id)
 
 	assert.NoError(t, err)
 	assert.Equal(t, postEx, res)
 	db.(*mocks.PostDataFunctional).
-		On("GetFilter", context.TODO(), bson.M{}).
+		On("Find", context.TODO(), post.Filter{}, post.Page{Sort: ranking.Top, Period: ranking.All}).
 		Return([]*post.Post{postEx, postEx2}, nil)
 
-	res0, err := DB.GetAll()
+	res0, err := DB.GetAll(post.Page{})
 	assert.NoError(t, err)
-	assert.Equal(t, []*post.Post{postEx, postEx2}, res0)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx, postEx2}}, res0)
 
 	db.(*mocks.PostDataFunctional).
-		On("GetFilter", context.TODO(), bson.M{"category": "music"}).
+		On("Find", context.TODO(), post.Filter{Category: "music"}, post.Page{Sort: ranking.Top, Period: ranking.All}).
 		Return([]*post.Post{postEx2}, nil)
 
-	res1, err := DB.GetInCategory("music")
+	res1, err := DB.GetInCategory("music", post.Page{})
 	assert.NoError(t, err)
-	assert.Equal(t, []*post.Post{postEx2}, res1)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx2}}, res1)
 
 	userName := postEx2.AuthorID
 	db.(*mocks.PostDataFunctional).
-		On("GetFilter", context.TODO(), bson.M{"authorID": userName}).
+		On("Find", context.TODO(), post.Filter{AuthorID: userName}, post.Page{Sort: ranking.Top, Period: ranking.All}).
 		Return([]*post.Post{postEx2}, nil)
 
-	res2, err := DB.GetFromUser(userName)
+	res2, err := DB.GetFromUser(userName, post.Page{})
 	assert.NoError(t, err)
-	assert.Equal(t, []*post.Post{postEx2}, res2)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx2}}, res2)
 }
 
-func TestAddComment(t *testing.T) {
+func TestGetsPaged(t *testing.T) {
 	db := InitMock()
-	postId := postEx.ID
-	postans := postEx
-	postans.Comments = []comment.Comment{
-		{postEx2.Author, "textCom", "89789", 0},
-	}
-	db.(*mocks.PostDataFunctional).
-		On("Get", postId).
-		Return(postEx, nil)
+	DB := NewPostDB(db, idgen.NewSequence(0))
+
 	db.(*mocks.PostDataFunctional).
-		On("AddComm", postEx).
-		Return(postans, nil)
+		On("Find", context.TODO(), post.Filter{}, post.Page{Limit: 2, Sort: ranking.Top, Period: ranking.All}).
+		Return([]*post.Post{postEx, postEx2, postExCom}, nil)
 
-	DB := NewPostDB(db)
+	res, err := DB.GetAll(post.Page{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx}, Next: postEx.ID}, res)
 
-	res, err := DB.AddComment(postId, "textCom", &postEx2.Author)
+	db.(*mocks.PostDataFunctional).
+		On("Find", context.TODO(), post.Filter{Category: "music"}, post.Page{Limit: 3, After: postEx.ID, Sort: ranking.Top, Period: ranking.All}).
+		Return([]*post.Post{postEx2, postExCom}, nil)
 
+	res, err = DB.GetInCategory("music", post.Page{Limit: 2, After: postEx.ID})
 	assert.NoError(t, err)
-	assert.Equal(t, postEx, res)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx2, postExCom}}, res)
 
 	db.(*mocks.PostDataFunctional).
-		On("Get", "89").
-		Return(nil, errors.New("some db err"))
-	db.(*mocks.PostDataFunctional).
-		On("AddComm", postEx).
-		Return(postans, nil)
+		On("Find", context.TODO(), post.Filter{AuthorID: "nobody"}, post.Page{Limit: 3, After: "404", Sort: ranking.Top, Period: ranking.All}).
+		Return(nil, ErrBadCursor)
 
-	res0, err0 := DB.AddComment("89", "textCom0", &postEx2.Author)
+	res, err = DB.GetFromUser("nobody", post.Page{Limit: 2, After: "404"})
+	assert.Empty(t, res)
+	assert.Equal(t, ErrBadCursor, err)
+}
 
-	assert.Empty(t, res0)
-	assert.EqualError(t, err0, "some db err")
+func TestGetsSorted(t *testing.T) {
+	db := InitMock()
+	DB := NewPostDB(db, idgen.NewSequence(0))
 
 	db.(*mocks.PostDataFunctional).
-		On("Get", "93").
-		Return(postEx2, nil)
+		On("Find", context.TODO(), post.Filter{}, post.Page{Sort: ranking.Hot, Period: ranking.All}).
+		Return([]*post.Post{postEx2, postEx}, nil)
+
+	res, err := DB.GetAll(post.Page{Sort: ranking.Hot})
+	assert.NoError(t, err)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx2, postEx}}, res)
+
 	db.(*mocks.PostDataFunctional).
-		On("AddComm", postEx2).
-		Return(nil, errors.New("some db err"))
+		On("Find", context.TODO(), post.Filter{Category: "music"}, post.Page{Sort: ranking.Top, Period: ranking.Week}).
+		Return([]*post.Post{postEx2}, nil)
 
-	res1, err1 := DB.AddComment("93", "textCom0", &postEx2.Author)
+	res, err = DB.GetInCategory("music", post.Page{Sort: ranking.Top, Period: ranking.Week})
+	assert.NoError(t, err)
+	assert.Equal(t, &post.Listing{Posts: []*post.Post{postEx2}}, res)
 
-	assert.Empty(t, res1)
-	assert.EqualError(t, err1, "some db err")
+	_, err = DB.GetAll(post.Page{Sort: "best"})
+	assert.Equal(t, ranking.ErrBadSort, err)
+	_, err = DB.GetAll(post.Page{Sort: ranking.Top, Period: "year"})
+	assert.Equal(t, ranking.ErrBadPeriod, err)
+}
 
+func TestUpdateScore(t *testing.T) {
+	created := time.Date(2022, 5, 10, 10, 31, 10, 0, time.UTC)
+	p := &post.Post{
+		Created: created.Format(time.RFC3339),
+		Votes:   []vote.Vote{{User: 1, Vote: 1}, {User: 2, Vote: 1}, {User: 3, Vote: -1}},
+	}
+	UpdateScore(p)
+	assert.Equal(t, 1, p.Score)
+	assert.Equal(t, 66, p.UpvotePercentage)
+	assert.Equal(t, 2, p.Ups)
+	assert.Equal(t, 1, p.Downs)
+	assert.Equal(t, ranking.HotScore(1, created), p.Hot)
+	assert.Equal(t, ranking.Controversy(2, 1), p.Controversy)
 }
 
-func TestDeleteComment(t *testing.T) {
+func TestUpdate(t *testing.T) {
 	db := InitMock()
-	postId := postExCom.ID
-	postans := *postExCom
-	postans.Comments = []comment.Comment{}
-	DB := NewPostDB(db)
-
+	textPost := &post.Post{ID: "7", AuthorID: "arin0", Type: "text", Title: "title", Text: "text"}
+	linkPost := &post.Post{ID: "8", AuthorID: "arin0", Type: "link", Title: "title", URL: "http://a.ru"}
+	db.(*mocks.PostDataFunctional).
+		On("Get", "7").
+		Return(textPost, nil)
+	db.(*mocks.PostDataFunctional).
+		On("Get", "8").
+		Return(linkPost, nil)
+	untouched := &post.Post{ID: "9", AuthorID: "arin0", Type: "text", Title: "title", Text: "text"}
 	db.(*mocks.PostDataFunctional).
-		On("Get", postId).
-		Return(postExCom, nil)
+		On("Get", "9").
+		Return(untouched, nil)
+	db.(*mocks.PostDataFunctional).
+		On("Update", textPost).
+		Return(textPost, nil)
+	db.(*mocks.PostDataFunctional).
+		On("Update", linkPost).
+		Return(linkPost, nil)
+
+	DB := NewPostDB(db, idgen.NewSequence(0))
+	author := &user.User{ID: 3, Login: "arin0"}
+	title, text, url := "new title", "new text", "http://b.ru"
+
+	res, err := DB.Update("7", &post.Changes{Title: &title, Text: &text}, author)
+	assert.NoError(t, err)
+	assert.Equal(t, "new title", res.Title)
+	assert.Equal(t, "new text", res.Text)
+	updated, err := time.Parse(time.RFC3339, res.Updated)
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, updated.Location())
+
+	res, err = DB.Update("8", &post.Changes{URL: &url}, author)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://b.ru", res.URL)
+
+	_, err = DB.Update("7", &post.Changes{URL: &url}, author)
+	assert.Equal(t, ErrBadPostType, err)
+	_, err = DB.Update("8", &post.Changes{Text: &text}, author)
+	assert.Equal(t, ErrBadPostType, err)
+	_, err = DB.Update("7", &post.Changes{Title: &title}, &user.User{ID: 4, Login: "other"})
+	assert.Equal(t, ErrNotAuthor, err)
+
+	// nothing to change, the post is not even stored again
+	res, err = DB.Update("9", &post.Changes{}, author)
+	assert.NoError(t, err)
+	assert.Equal(t, untouched, res)
+	assert.Empty(t, res.Updated)
+	db.(*mocks.PostDataFunctional).AssertNotCalled(t, "Update", untouched)
+}
+
+func TestAddComment(t *testing.T) {
+	db := InitMock()
+	postId := postEx.ID
+	postans := *postEx
+	postans.Comments = []comment.Comment{
+		{Author: postEx2.Author, Body: "textCom", Created: "89789", ID: 0},
+	}
+	isComment := func(text string) interface{} {
+		return mock.MatchedBy(func(c *comment.Comment) bool {
+			return c.Body == text && c.Author == postEx2.Author && c.ParentID == nil
+		})
+	}
 	db.(*mocks.PostDataFunctional).
-		On("DeleteComm", &postans).
+		On("AddComm", postId, isComment("textCom")).
 		Return(&postans, nil)
 
-	res, err := DB.DeleteComment(postId, int64(1))
+	DB := NewPostDB(db, idgen.NewSequence(0))
+
+	res, err := DB.AddComment(postId, "textCom", &postEx2.Author)
 
 	assert.NoError(t, err)
 	assert.Equal(t, &postans, res)
 
 	db.(*mocks.PostDataFunctional).
-		On("Get", "89").
-		Return(nil, errors.New("some db err"))
-	db.(*mocks.PostDataFunctional).
-		On("DeleteComm", postExCom).
-		Return(&postans, nil)
+		On("AddComm", "89", isComment("textCom0")).
+		Return(nil, ErrNoPost)
 
-	res0, err0 := DB.DeleteComment("89", 0)
+	res0, err0 := DB.AddComment("89", "textCom0", &postEx2.Author)
 
 	assert.Empty(t, res0)
-	assert.EqualError(t, err0, "some db err")
+	assert.Equal(t, ErrNoPost, err0)
+}
 
-	postans2 := *postEx2
-	postans2.Comments = []comment.Comment{}
+func TestAddReply(t *testing.T) {
+	db := InitMock()
+	parent := int64(0)
+	postReply := &post.Post{
+		ID: "5",
+		Comments: []comment.Comment{
+			{Author: postEx.Author, Body: "textCom", Created: "89789", ID: 0},
+			{Author: postEx2.Author, Body: "reply", Created: "89790", ID: 1, ParentID: &parent},
+		},
+	}
+	isReply := func(parent int64) interface{} {
+		return mock.MatchedBy(func(c *comment.Comment) bool {
+			return c.Body == "reply" && c.ParentID != nil && *c.ParentID == parent
+		})
+	}
 	db.(*mocks.PostDataFunctional).
-		On("Get", "93").
-		Return(postEx2, nil)
+		On("AddComm", "5", isReply(0)).
+		Return(postReply, nil)
 	db.(*mocks.PostDataFunctional).
-		On("DeleteComm", &postans2).
-		Return(nil, errors.New("some db err"))
+		On("AddComm", "5", isReply(9)).
+		Return(nil, comment.ErrNoComment)
 
-	res1, err1 := DB.DeleteComment("93", 0)
+	DB := NewPostDB(db, idgen.NewSequence(0))
+
+	res, err := DB.AddReply("5", 0, "reply", &postEx2.Author)
+	assert.NoError(t, err)
+	assert.Equal(t, postReply, res)
 
-	assert.Empty(t, res1)
-	assert.EqualError(t, err1, "some db err")
+	res0, err0 := DB.AddReply("5", 9, "reply", &postEx2.Author)
+	assert.Empty(t, res0)
+	assert.Equal(t, comment.ErrNoComment, err0)
 }
 
-func TestUpdateVote(t *testing.T) {
+func TestEditComment(t *testing.T) {
 	db := InitMock()
-	DB := NewPostDB(db)
-	postEx = &post.Post{Author: user.User{ID: 3, Login: "arin0"}, AuthorID: "arin0", Category: "programming", Comments: []comment.Comment{}, Created: "2022-05-10T13:31:10+03:00", ID: "1", Score: 1, Text: "Post Text exemple", Title: "Post Title ex", Type: "text", UpvotePercentage: 100, Views: 1, Votes: []vote.Vote{{User: 3, Vote: 1}}}
-	postId := postEx.ID
-	postans := *postEx
-	postans.Score = 0
-	postans.UpvotePercentage = 0
-	postans.Votes = []vote.Vote{}
-
+	postEdit := &post.Post{
+		ID: "6",
+		Comments: []comment.Comment{{Author: postEx.Author, Body: "edited", Created: "89789", ID: 0,
+			History: []comment.Revision{{Body: "textCom", Created: "89789"}}}},
+	}
+	other := &user.User{ID: 9, Login: "other"}
 	db.(*mocks.PostDataFunctional).
-		On("Get", postId).
-		Return(postEx, nil)
+		On("EditComm", "6", int64(0), "edited", &postEx.Author).
+		Return(postEdit, nil)
 	db.(*mocks.PostDataFunctional).
-		On("UpVote", &postans).
-		Return(&postans, nil)
+		On("EditComm", "6", int64(0), "edited", other).
+		Return(nil, comment.ErrNotAuthor)
 
-	res, err := DB.UpdateVote(1, postId, &user.User{ID: 3, Login: "arin0"})
+	DB := NewPostDB(db, idgen.NewSequence(0))
 
+	res, err := DB.EditComment("6", 0, "edited", &postEx.Author)
 	assert.NoError(t, err)
-	assert.Equal(t, &postans, res)
+	assert.Equal(t, postEdit, res)
 
-	postEx4 := &post.Post{Author: user.User{ID: 3, Login: "arin0"}, AuthorID: "arin0", Category: "programming", Comments: []comment.Comment{}, Created: "2022-05-10T13:31:10+03:00", ID: "4", Score: 1, Text: "Post Text exemple", Title: "Post Title ex", Type: "text", UpvotePercentage: 100, Views: 1, Votes: []vote.Vote{{User: 3, Vote: 1}}}
-	postId = postEx4.ID
-	postans3 := *postEx4
-	postans3.Score = 2
-	postans3.UpvotePercentage = 100
-	postans3.Votes = []vote.Vote{{User: 3, Vote: 1}, {User: 1, Vote: 1}}
+	res0, err0 := DB.EditComment("6", 0, "edited", other)
+	assert.Empty(t, res0)
+	assert.Equal(t, comment.ErrNotAuthor, err0)
+}
+
+func TestDeleteComment(t *testing.T) {
+	db := InitMock()
+	postId := postExCom.ID
+	postans := *postExCom
+	postans.Comments = []comment.Comment{}
+	DB := NewPostDB(db, idgen.NewSequence(0))
 
 	db.(*mocks.PostDataFunctional).
-		On("Get", postId).
-		Return(postEx4, nil)
-	db.(*mocks.PostDataFunctional).
-		On("UpVote", &postans3).
-		Return(&postans3, nil)
+		On("DeleteComm", postId, int64(1)).
+		Return(&postans, nil)
 
-	res3, err := DB.UpdateVote(1, postId, &user.User{ID: 1, Login: "arin0"})
+	res, err := DB.DeleteComment(postId, int64(1))
 
 	assert.NoError(t, err)
-	assert.Equal(t, &postans3, res3)
+	assert.Equal(t, &postans, res)
 
-	res3, err3 := DB.UpdateVote(6, postId, &user.User{ID: 3, Login: "arin0"})
-	assert.Empty(t, res3)
-	assert.EqualError(t, err3, vote.ErrBadVote.Error())
 	db.(*mocks.PostDataFunctional).
-		On("Get", "89").
+		On("DeleteComm", "89", int64(0)).
 		Return(nil, errors.New("some db err"))
-	db.(*mocks.PostDataFunctional).
-		On("UpVote", &postans).
-		Return(&postans, nil)
 
-	res0, err0 := DB.UpdateVote(-1, "89", &user.User{ID: 3, Login: "arin0"})
+	res0, err0 := DB.DeleteComment("89", 0)
 
 	assert.Empty(t, res0)
 	assert.EqualError(t, err0, "some db err")
+}
+
+func TestUpdateVote(t *testing.T) {
+	db := InitMock()
+	DB := NewPostDB(db, idgen.NewSequence(0))
+	postans := *postEx
+	postans.Score = 2
+	postans.Votes = []vote.Vote{{User: 3, Vote: 1}, {User: 1, Vote: 1}}
 
-	postans2 := *postEx
-	postans2.Score = -1
-	postans2.UpvotePercentage = 0
-	postans2.Votes = []vote.Vote{{User: 3, Vote: -1}}
-	db.(*mocks.PostDataFunctional).
-		On("Get", "93").
-		Return(postEx, nil)
 	db.(*mocks.PostDataFunctional).
-		On("UpVote", &postans2).
-		Return(nil, errors.New("some db err"))
+		On("Vote", postEx.ID, int64(1), 1).
+		Return(&postans, nil)
 
-	res1, err1 := DB.UpdateVote(-1, "93", &user.User{ID: 3, Login: "arin0"})
+	res, err := DB.UpdateVote(1, postEx.ID, &user.User{ID: 1, Login: "first"})
+	assert.NoError(t, err)
+	assert.Equal(t, &postans, res)
 
-	assert.Empty(t, res1)
-	assert.EqualError(t, err1, "some db err")
+	res, err = DB.UpdateVote(6, postEx.ID, &user.User{ID: 3, Login: "arin0"})
+	assert.Empty(t, res)
+	assert.EqualError(t, err, vote.ErrBadVote.Error())
 
+	db.(*mocks.PostDataFunctional).
+		On("Vote", "89", int64(3), -1).
+		Return(nil, ErrNoPost)
+
+	res, err = DB.UpdateVote(-1, "89", &user.User{ID: 3, Login: "arin0"})
+	assert.Empty(t, res)
+	assert.Equal(t, ErrNoPost, err)
 }
+
 func TestDelete(t *testing.T) {
 	db := InitMock()
 	id := postEx.ID
@@ -304,7 +422,7 @@ func TestDelete(t *testing.T) {
 		On("Delete", id).
 		Return(true, nil)
 
-	DB := NewPostDB(db)
+	DB := NewPostDB(db, idgen.NewSequence(0))
 	res, err := DB.Delete(id)
 
 	assert.NoError(t, err)
@@ -0,0 +1,267 @@
+package repo
+
+import (
+	"context"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/search"
+	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PostMemoryRepo keeps posts in memory, it is used in tests and when the
+// server runs without a database. Posts go in and out as copies so callers
+// never share them with the storage.
+type PostMemoryRepo struct {
+	data  map[string]*post.Post
+	index *search.Index
+	mutex sync.RWMutex
+}
+
+func NewPostMemoryRepo() *PostMemoryRepo {
+	return &PostMemoryRepo{
+		data:  make(map[string]*post.Post),
+		index: search.NewIndex(),
+	}
+}
+
+func clonePost(p *post.Post) *post.Post {
+	res := *p
+	if p.Comments != nil {
+		res.Comments = make([]comment.Comment, len(p.Comments))
+		copy(res.Comments, p.Comments)
+		for i := range res.Comments {
+			if p.Comments[i].History != nil {
+				res.Comments[i].History = append([]comment.Revision(nil), p.Comments[i].History...)
+			}
+		}
+	}
+	if p.Votes != nil {
+		res.Votes = append(p.Votes[:0:0], p.Votes...)
+	}
+	return &res
+}
+
+// reindex must be called with the mutex locked.
+func (repo *PostMemoryRepo) reindex(p *post.Post) {
+	fields := []search.Field{
+		{Text: p.Title, Weight: 10},
+		{Text: p.Text, Weight: 5},
+	}
+	for _, item := range p.Comments {
+		if !item.Deleted {
+			fields = append(fields, search.Field{Text: item.Body, Weight: 1})
+		}
+	}
+	repo.index.Add(p.ID, fields...)
+}
+
+func (repo *PostMemoryRepo) Len() int64 {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return int64(len(repo.data))
+}
+
+func (repo *PostMemoryRepo) Add(c *post.Post) (*post.Post, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[c.ID]; ok {
+		return nil, ErrDuplicateID
+	}
+	repo.data[c.ID] = clonePost(c)
+	repo.reindex(c)
+	return c, nil
+}
+
+func (repo *PostMemoryRepo) Get(id string) (*post.Post, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	p, ok := repo.data[id]
+	if !ok {
+		return nil, ErrNoPost
+	}
+	return clonePost(p), nil
+}
+
+func (repo *PostMemoryRepo) IncViews(id string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	p, ok := repo.data[id]
+	if !ok {
+		return 0, ErrNoPost
+	}
+	p.Views++
+	return p.Views, nil
+}
+
+// modify runs change on the stored post with the mutex locked.
+func (repo *PostMemoryRepo) modify(id string, change func(p *post.Post)) (*post.Post, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	p, ok := repo.data[id]
+	if !ok {
+		return nil, ErrNoPost
+	}
+	change(p)
+	repo.reindex(p)
+	return clonePost(p), nil
+}
+
+func (repo *PostMemoryRepo) Update(c *post.Post) (*post.Post, error) {
+	upd := clonePost(c)
+	return repo.modify(c.ID, func(p *post.Post) {
+		p.Title, p.Text, p.URL, p.Updated = upd.Title, upd.Text, upd.URL, upd.Updated
+	})
+}
+
+// goesBefore tells whether a is listed before b in the order s.
+func goesBefore(a, b *post.Post, s ranking.Sort) bool {
+	var less, greater bool
+	switch s {
+	case ranking.Hot:
+		less, greater = a.Hot < b.Hot, a.Hot > b.Hot
+	case ranking.New:
+		less, greater = a.Created < b.Created, a.Created > b.Created
+	case ranking.Controversial:
+		less, greater = a.Controversy < b.Controversy, a.Controversy > b.Controversy
+	default:
+		less, greater = a.Score < b.Score, a.Score > b.Score
+	}
+	if less || greater {
+		return greater
+	}
+	return a.ID > b.ID
+}
+
+func matches(p *post.Post, filter post.Filter) bool {
+	return (filter.Category == "" || p.Category == filter.Category) &&
+		(filter.AuthorID == "" || p.AuthorID == filter.AuthorID)
+}
+
+func (repo *PostMemoryRepo) Find(ctx context.Context, filter post.Filter, page post.Page) ([]*post.Post, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	var last *post.Post
+	if page.After != "" {
+		var ok bool
+		last, ok = repo.data[page.After]
+		if !ok {
+			return nil, ErrBadCursor
+		}
+	}
+	since := ""
+	if page.Sort == ranking.Top || page.Sort == ranking.Controversial {
+		if t := page.Period.Since(time.Now()); !t.IsZero() {
+			since = t.UTC().Format(time.RFC3339)
+		}
+	}
+	var arr []*post.Post
+	for _, p := range repo.data {
+		if !matches(p, filter) || p.Created < since || last != nil && !goesBefore(last, p, page.Sort) {
+			continue
+		}
+		arr = append(arr, p)
+	}
+	sort.Slice(arr, func(i, j int) bool { return goesBefore(arr[i], arr[j], page.Sort) })
+	if page.Limit > 0 && int64(len(arr)) > page.Limit {
+		arr = arr[:page.Limit]
+	}
+	for i := range arr {
+		arr[i] = clonePost(arr[i])
+	}
+	return arr, nil
+}
+
+func (repo *PostMemoryRepo) Search(ctx context.Context, text string, filter post.Filter, limit int64) ([]*post.Post, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	var arr []*post.Post
+	for _, hit := range repo.index.Search(text) {
+		if limit > 0 && int64(len(arr)) == limit {
+			break
+		}
+		p, ok := repo.data[hit.ID]
+		if ok && matches(p, filter) {
+			arr = append(arr, clonePost(p))
+		}
+	}
+	return arr, nil
+}
+
+// AddComm gives the comment the next ID of the post and appends it. A reply
+// needs a parent that is not deleted.
+func (repo *PostMemoryRepo) AddComm(id string, item *comment.Comment) (*post.Post, error) {
+	var err error
+	res, errPost := repo.modify(id, func(p *post.Post) {
+		if item.ParentID != nil && !comment.CanReply(p.Comments, *item.ParentID) {
+			err = comment.ErrNoComment
+			return
+		}
+		p.LastCommentID++
+		item.ID = p.LastCommentID
+		p.Comments = append(p.Comments, *item)
+	})
+	if errPost != nil {
+		return nil, errPost
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// EditComm edits the comment under the lock of the post, see comment.Edit.
+func (repo *PostMemoryRepo) EditComm(id string, idComment int64, text string, author *user.User) (*post.Post, error) {
+	var err error
+	res, errPost := repo.modify(id, func(p *post.Post) {
+		_, err = comment.Edit(p.Comments, idComment, text, author)
+	})
+	if errPost != nil {
+		return nil, errPost
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (repo *PostMemoryRepo) DeleteComm(id string, idComment int64) (*post.Post, error) {
+	return repo.modify(id, func(p *post.Post) {
+		p.Comments = comment.Delete(p.Comments, idComment)
+	})
+}
+
+func (repo *PostMemoryRepo) Vote(id string, userID int64, coin int) (*post.Post, error) {
+	var err error
+	res, errPost := repo.modify(id, func(p *post.Post) {
+		var votes []vote.Vote
+		votes, err = vote.MakeVoteArr(p.Votes, coin, &user.User{ID: userID})
+		if err != nil {
+			return
+		}
+		p.Votes = votes
+		UpdateScore(p)
+	})
+	if errPost != nil {
+		return nil, errPost
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (repo *PostMemoryRepo) Delete(id string) (bool, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[id]; !ok {
+		return false, nil
+	}
+	delete(repo.data, id)
+	repo.index.Remove(id)
+	return true, nil
+}
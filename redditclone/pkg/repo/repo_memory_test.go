@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/user"
+	"sync"
+	"testing"
+)
+
+func memoryDB(t *testing.T) *PostDB {
+	DB := NewPostDB(NewPostMemoryRepo(), idgen.NewSequence(0))
+	author := user.User{ID: 3, Login: "arin0"}
+	other := user.User{ID: 4, Login: "other"}
+	for _, p := range []*post.Post{
+		{Author: author, Category: "programming", Type: "text", Title: "Learning Go", Text: "channels and goroutines"},
+		{Author: author, Category: "music", Type: "text", Title: "Music of the week", Text: "go listen"},
+		{Author: other, Category: "programming", Type: "link", Title: "Rust book", URL: "https://doc.rust-lang.org/book/"},
+	} {
+		_, err := DB.Add(p)
+		assert.NoError(t, err)
+	}
+	return DB
+}
+
+func ids(posts []*post.Post) []string {
+	res := make([]string, 0, len(posts))
+	for _, p := range posts {
+		res = append(res, p.ID)
+	}
+	return res
+}
+
+func TestMemoryFind(t *testing.T) {
+	DB := memoryDB(t)
+	_, err := DB.UpdateVote(1, "3", &user.User{ID: 1, Login: "first"})
+	assert.NoError(t, err)
+
+	res, err := DB.GetAll(post.Page{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, ids(res.Posts))
+
+	res, err = DB.GetAll(post.Page{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2"}, ids(res.Posts))
+	assert.Equal(t, "2", res.Next)
+
+	res, err = DB.GetAll(post.Page{Limit: 2, After: res.Next})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids(res.Posts))
+	assert.Empty(t, res.Next)
+
+	res, err = DB.GetInCategory("programming", post.Page{Sort: ranking.Hot})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "1"}, ids(res.Posts))
+
+	res, err = DB.GetFromUser("arin0", post.Page{Sort: ranking.New, Period: ranking.Day})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, ids(res.Posts))
+
+	_, err = DB.GetAll(post.Page{After: "404", Limit: 1})
+	assert.Equal(t, ErrBadCursor, err)
+}
+
+func TestMemorySearch(t *testing.T) {
+	DB := memoryDB(t)
+
+	res, err := DB.Search("go", post.Filter{}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids(res))
+
+	res, err = DB.Search("go", post.Filter{Category: "music"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(res))
+
+	res, err = DB.Search("go", post.Filter{}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids(res))
+
+	_, err = DB.AddComment("3", "better than go?", &user.User{ID: 3, Login: "arin0"})
+	assert.NoError(t, err)
+	res, err = DB.Search("GO", post.Filter{AuthorID: "other"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3"}, ids(res))
+
+	_, err = DB.DeleteComment("3", 0)
+	assert.NoError(t, err)
+	res, err = DB.Search("go", post.Filter{AuthorID: "other"}, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+
+	_, err = DB.Search("  ", post.Filter{}, 0)
+	assert.Equal(t, ErrEmptyQuery, err)
+}
+
+func TestMemoryViews(t *testing.T) {
+	DB := memoryDB(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := DB.AddView("1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	p, err := DB.Get("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 50, p.Views)
+
+	_, err = DB.AddView("404")
+	assert.Equal(t, ErrNoPost, err)
+}
+
+func TestMemoryComments(t *testing.T) {
+	DB := memoryDB(t)
+	author := &user.User{ID: 3, Login: "arin0"}
+
+	p, err := DB.AddComment("1", "first", author)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), p.Comments[0].ID)
+	p, err = DB.AddReply("1", 0, "reply", author)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), p.Comments[1].ID)
+
+	p, err = DB.DeleteComment("1", 1)
+	assert.NoError(t, err)
+	assert.Len(t, p.Comments, 1)
+	// the ID of a deleted comment is never given out again
+	p, err = DB.AddComment("1", "second", author)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), p.Comments[1].ID)
+
+	_, err = DB.AddReply("1", 1, "to deleted", author)
+	assert.Equal(t, comment.ErrNoComment, err)
+	_, err = DB.AddComment("404", "nowhere", author)
+	assert.Equal(t, ErrNoPost, err)
+
+	p, err = DB.EditComment("1", 2, "second edited", author)
+	assert.NoError(t, err)
+	assert.Equal(t, "second edited", p.Comments[1].Body)
+	assert.Equal(t, "second", p.Comments[1].History[0].Body)
+	_, err = DB.EditComment("1", 2, "not mine", &user.User{ID: 4, Login: "other"})
+	assert.Equal(t, comment.ErrNotAuthor, err)
+	_, err = DB.EditComment("1", 1, "deleted", author)
+	assert.Equal(t, comment.ErrNoComment, err)
+	_, err = DB.EditComment("404", 0, "nowhere", author)
+	assert.Equal(t, ErrNoPost, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := DB.AddComment("2", "concurrent", author)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	p, err = DB.Get("2")
+	assert.NoError(t, err)
+	assert.Len(t, p.Comments, 100)
+	seen := make(map[int64]bool)
+	for _, c := range p.Comments {
+		assert.False(t, seen[c.ID])
+		seen[c.ID] = true
+	}
+}
+
+func TestMemoryAdd(t *testing.T) {
+	DB := memoryDB(t)
+	res, err := DB.GetAll(post.Page{Sort: ranking.New})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, ids(res.Posts))
+
+	data := NewPostMemoryRepo()
+	_, err = data.Add(&post.Post{ID: "1"})
+	assert.NoError(t, err)
+	_, err = data.Add(&post.Post{ID: "1"})
+	assert.Equal(t, ErrDuplicateID, err)
+}
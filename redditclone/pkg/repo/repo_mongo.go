@@ -4,8 +4,15 @@ import (
 	"context"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/idgen"
 	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
+	"time"
 )
 
 type PostMongoRepo struct {
@@ -26,10 +33,43 @@ func (repo *PostMongoRepo) Len() int64 {
 	return len
 }
 
+// LastID returns the highest numeric post ID, 0 without numeric IDs. IDs
+// are compared as numbers, so "10" goes after "9".
+func (repo *PostMongoRepo) LastID(ctx context.Context) (int64, error) {
+	cur, err := repo.data.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"id": bson.M{"$regex": "^[0-9]+$"}}}},
+		{{Key: "$project", Value: bson.M{"num": bson.M{"$convert": bson.M{"input": "$id", "to": "long", "onError": nil}}}}},
+		{{Key: "$sort", Value: bson.M{"num": -1}}},
+		{{Key: "$limit", Value: 1}},
+	})
+	if err != nil {
+		log.Println("err in LastID:", err)
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	res := struct {
+		Num int64 `bson:"num"`
+	}{}
+	if cur.Next(ctx) {
+		err = cur.Decode(&res)
+	} else {
+		err = cur.Err()
+	}
+	if err != nil {
+		log.Println("err in LastID:", err)
+		return 0, err
+	}
+	return res.Num, nil
+}
+
 func (repo *PostMongoRepo) Add(c *post.Post) (*post.Post, error) {
 	_, err := repo.data.InsertOne(context.TODO(), c)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateID
+	}
 	if err != nil {
-		log.Println(err)
+		log.Println("err in Add post:", err)
+		return nil, err
 	}
 	return c, nil
 }
@@ -37,6 +77,9 @@ func (repo *PostMongoRepo) Add(c *post.Post) (*post.Post, error) {
 func (repo *PostMongoRepo) Get(id string) (*post.Post, error) {
 	post := &post.Post{}
 	err := repo.data.FindOne(context.TODO(), bson.M{"id": id}).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
+	}
 	if err != nil {
 		log.Println("err in Get Post:", err)
 		return nil, err
@@ -44,54 +87,600 @@ func (repo *PostMongoRepo) Get(id string) (*post.Post, error) {
 	return post, nil
 }
 
-func (repo *PostMongoRepo) GetFilter(ctx context.Context, filter interface{}) ([]*post.Post, error) {
+// IncViews increments the views in the database so concurrent views are
+// never lost.
+func (repo *PostMongoRepo) IncViews(id string) (int, error) {
+	res := struct {
+		Views int `bson:"views"`
+	}{}
+	err := repo.data.FindOneAndUpdate(context.TODO(), bson.M{"id": id},
+		bson.M{"$inc": bson.M{"views": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"views": 1}),
+	).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrNoPost
+	}
+	if err != nil {
+		log.Println("err in IncViews:", err)
+		return 0, err
+	}
+	return res.Views, nil
+}
+
+func (repo *PostMongoRepo) Update(post *post.Post) (*post.Post, error) {
+	res, err := repo.data.UpdateOne(context.TODO(), bson.M{"id": post.ID}, bson.M{
+		"$set": bson.M{"title": post.Title, "text": post.Text, "url": post.URL, "updated": post.Updated},
+	})
+	if err != nil {
+		log.Println("err in update bd in Update:", err)
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, ErrNoPost
+	}
+	return post, nil
+}
+
+// sortFields maps a listing order to the post field it is sorted by.
+var sortFields = map[ranking.Sort]string{
+	ranking.Hot:           "hot",
+	ranking.New:           "created",
+	ranking.Top:           "score",
+	ranking.Controversial: "controversy",
+}
+
+// sortValue is the value of the field the listing is sorted by for p.
+func sortValue(p *post.Post, s ranking.Sort) interface{} {
+	switch s {
+	case ranking.Hot:
+		return p.Hot
+	case ranking.New:
+		return p.Created
+	case ranking.Controversial:
+		return p.Controversy
+	}
+	return p.Score
+}
+
+// DedupeIDs gives new IDs to the posts sharing an ID with an older post, so
+// the unique index of post IDs can be built over posts stored before it
+// existed. The oldest post keeps its ID. Once the index is there nothing is
+// left to do and the posts are not scanned again. It returns how many posts
+// got a new ID.
+func (repo *PostMongoRepo) DedupeIDs(ctx context.Context, ids idgen.Generator) (int, error) {
+	indexed, err := repo.hasUniqueID(ctx)
+	if err != nil || indexed {
+		return 0, err
+	}
+	cur, err := repo.data.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$id", "posts": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"posts.1": bson.M{"$exists": true}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		log.Println("err in find duplicate ids:", err)
+		return 0, err
+	}
+	var groups []struct {
+		Posts []interface{} `bson:"posts"`
+	}
+	err = cur.All(ctx, &groups)
+	if err != nil {
+		log.Println("err in find duplicate ids:", err)
+		return 0, err
+	}
+	n := 0
+	for _, group := range groups {
+		for _, dup := range group.Posts[1:] {
+			id, err := ids.NewID(ctx)
+			if err != nil {
+				return n, err
+			}
+			_, err = repo.data.UpdateOne(ctx, bson.M{"_id": dup}, bson.M{"$set": bson.M{"id": id}})
+			if err != nil {
+				log.Println("err in dedupe ids:", err)
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// hasUniqueID tells whether the unique index of post IDs is built.
+func (repo *PostMongoRepo) hasUniqueID(ctx context.Context) (bool, error) {
+	cur, err := repo.data.Indexes().List(ctx)
+	if err != nil {
+		log.Println("err in list indexes:", err)
+		return false, err
+	}
+	var indexes []struct {
+		Key    bson.D `bson:"key"`
+		Unique bool   `bson:"unique"`
+	}
+	err = cur.All(ctx, &indexes)
+	if err != nil {
+		log.Println("err in list indexes:", err)
+		return false, err
+	}
+	for _, index := range indexes {
+		if index.Unique && len(index.Key) == 1 && index.Key[0].Key == "id" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// EnsureIndexes creates the unique index of post IDs, the indexes the post
+// listings are sorted by, one per sort order with the id as a tie breaker the
+// cursor pages rely on, and the text index of the search.
+func (repo *PostMongoRepo) EnsureIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}}
+	for _, s := range []ranking.Sort{ranking.Hot, ranking.New, ranking.Top, ranking.Controversial} {
+		models = append(models, mongo.IndexModel{
+			Keys: bson.D{{Key: sortFields[s], Value: -1}, {Key: "id", Value: -1}},
+		})
+	}
+	models = append(models, mongo.IndexModel{
+		Keys: bson.D{{Key: "title", Value: "text"}, {Key: "text", Value: "text"}, {Key: "comments.body", Value: "text"}},
+		Options: options.Index().
+			SetName("search").
+			SetDefaultLanguage("none").
+			SetWeights(bson.M{"title": 10, "text": 5, "comments.body": 1}),
+	})
+	_, err := repo.data.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		log.Println("err in create indexes:", err)
+	}
+	return err
+}
+
+func (repo *PostMongoRepo) Find(ctx context.Context, filter post.Filter, page post.Page) ([]*post.Post, error) {
+	query := bson.M{}
+	if filter.Category != "" {
+		query["category"] = filter.Category
+	}
+	if filter.AuthorID != "" {
+		query["authorID"] = filter.AuthorID
+	}
+	field, ok := sortFields[page.Sort]
+	if !ok {
+		page.Sort, field = ranking.Top, "score"
+	}
+	if page.Sort == ranking.Top || page.Sort == ranking.Controversial {
+		if since := page.Period.Since(time.Now()); !since.IsZero() {
+			query["created"] = bson.M{"$gte": since.UTC().Format(time.RFC3339)}
+		}
+	}
+	if page.After != "" {
+		last, err := repo.Get(page.After)
+		if err == ErrNoPost {
+			return nil, ErrBadCursor
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := sortValue(last, page.Sort)
+		query["$or"] = bson.A{
+			bson.M{field: bson.M{"$lt": value}},
+			bson.M{field: value, "id": bson.M{"$lt": last.ID}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: field, Value: -1}, {Key: "id", Value: -1}})
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+
 	var arr []*post.Post
-	cur, err := repo.data.Find(ctx, filter)
+	cur, err := repo.data.Find(ctx, query, opts)
 	if err != nil {
 		log.Println("err in read from DB:", err)
 		return nil, err
 	}
-	for cur.Next(context.TODO()) {
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
 		var elem post.Post
 		err := cur.Decode(&elem)
 		if err != nil {
-			log.Fatal(err)
+			log.Println("err in decode post:", err)
+			return nil, err
 		}
 		arr = append(arr, &elem)
 	}
 	if err := cur.Err(); err != nil {
-		log.Fatal(err)
+		log.Println("err in read from DB:", err)
+		return nil, err
 	}
-	cur.Close(context.TODO())
 	return arr, nil
 }
 
-func (repo *PostMongoRepo) AddComm(post *post.Post) (*post.Post, error) {
-	_, err := repo.data.UpdateOne(context.TODO(), bson.M{"id": post.ID}, bson.D{
-		{"$set", bson.D{{"comments", post.Comments}}},
-	})
+// Search finds posts with the words of text in the title, the text or the
+// comments using the text index, the most relevant first.
+func (repo *PostMongoRepo) Search(ctx context.Context, text string, filter post.Filter, limit int64) ([]*post.Post, error) {
+	query := bson.M{"$text": bson.M{"$search": text}}
+	if filter.Category != "" {
+		query["category"] = filter.Category
+	}
+	if filter.AuthorID != "" {
+		query["authorID"] = filter.AuthorID
+	}
+	relevance := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"relevance": relevance}).
+		SetSort(bson.D{{Key: "relevance", Value: relevance}, {Key: "id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	var arr []*post.Post
+	cur, err := repo.data.Find(ctx, query, opts)
+	if err != nil {
+		log.Println("err in search in DB:", err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var elem post.Post
+		err := cur.Decode(&elem)
+		if err != nil {
+			log.Println("err in decode post:", err)
+			return nil, err
+		}
+		arr = append(arr, &elem)
+	}
+	if err := cur.Err(); err != nil {
+		log.Println("err in search in DB:", err)
+		return nil, err
+	}
+	return arr, nil
+}
+
+// AddComm takes the next comment ID of the post from its counter and pushes
+// the comment, so concurrent comments never overwrite each other and IDs are
+// never reused. A reply is pushed only while its parent is not deleted.
+func (repo *PostMongoRepo) AddComm(id string, item *comment.Comment) (*post.Post, error) {
+	ctx := context.TODO()
+	seq := struct {
+		LastCommentID int64 `bson:"lastCommentID"`
+	}{}
+	err := repo.data.FindOneAndUpdate(ctx, bson.M{"id": id},
+		bson.M{"$inc": bson.M{"lastCommentID": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"lastCommentID": 1}),
+	).Decode(&seq)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
+	}
+	if err != nil {
+		log.Println("err in next comment id:", err)
+		return nil, err
+	}
+	item.ID = seq.LastCommentID
+
+	filter := bson.M{"id": id}
+	if item.ParentID != nil {
+		filter["comments"] = bson.M{"$elemMatch": bson.M{"id": *item.ParentID, "deleted": bson.M{"$ne": true}}}
+	}
+	res := &post.Post{}
+	err = repo.data.FindOneAndUpdate(ctx, filter,
+		bson.M{"$push": bson.M{"comments": item}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(res)
+	if err == mongo.ErrNoDocuments {
+		return nil, comment.ErrNoComment
+	}
 	if err != nil {
 		log.Println("err in update bd in AddComment:", err)
+		return nil, err
 	}
-	return post, nil
+	return res, nil
 }
-func (repo *PostMongoRepo) DeleteComm(post *post.Post) (*post.Post, error) {
-	_, err := repo.data.ReplaceOne(context.TODO(), bson.M{"id": post.ID}, &post)
+
+// maxCommentAttempts bounds the retries of a comment edit or deletion when
+// the comment is edited or replied to at the same time.
+const maxCommentAttempts = 5
+
+// EditComm sets the text of the comment and pushes the previous one to its
+// history with one conditional update. It only matches while the comment is
+// not deleted, author wrote it and it still has the text the history entry
+// was made of, otherwise the post is read again to tell why.
+func (repo *PostMongoRepo) EditComm(id string, idComment int64, text string, author *user.User) (*post.Post, error) {
+	ctx := context.TODO()
+	for attempt := 0; attempt < maxCommentAttempts; attempt++ {
+		p, err := repo.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		item, err := comment.Editable(p.Comments, idComment, author)
+		if err != nil {
+			return nil, err
+		}
+		match := bson.M{
+			"id":           idComment,
+			"deleted":      bson.M{"$ne": true},
+			"author.login": author.Login,
+			"body":         item.Body,
+			"edited":       item.Edited,
+		}
+		if item.Edited == "" {
+			match["edited"] = bson.M{"$exists": false}
+		}
+		res, err := repo.data.UpdateOne(ctx, bson.M{"id": id, "comments": bson.M{"$elemMatch": match}}, bson.M{
+			"$set": bson.M{
+				"comments.$.body":   text,
+				"comments.$.edited": time.Now().Format(time.RFC3339),
+			},
+			"$push": bson.M{"comments.$.history": item.Revision()},
+		})
+		if err != nil {
+			log.Println("err in update bd in EditComment:", err)
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			continue
+		}
+		return repo.Get(id)
+	}
+	return nil, ErrCommentConflict
+}
+
+// DeleteComm tombstones or pulls the comment as comment.Delete would. The
+// pull only goes through while nobody has replied to the removed comments,
+// otherwise the deletion is planned again.
+func (repo *PostMongoRepo) DeleteComm(id string, idComment int64) (*post.Post, error) {
+	ctx := context.TODO()
+	for attempt := 0; attempt < maxCommentAttempts; attempt++ {
+		p, err := repo.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		plan, ok := comment.PlanDelete(p.Comments, idComment)
+		if !ok {
+			return p, nil
+		}
+		filter := bson.M{"id": id}
+		update := bson.M{"$pull": bson.M{"comments": bson.M{"id": bson.M{"$in": plan.Remove}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if plan.Tombstone {
+			update = bson.M{
+				"$set": bson.M{
+					"comments.$[c].body":    "",
+					"comments.$[c].author":  user.User{},
+					"comments.$[c].deleted": true,
+				},
+				"$unset": bson.M{"comments.$[c].history": ""},
+			}
+			opts.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"c.id": idComment}}})
+		} else {
+			filter["comments"] = bson.M{"$not": bson.M{"$elemMatch": bson.M{
+				"parentID": bson.M{"$in": plan.Remove},
+				"id":       bson.M{"$nin": plan.Remove},
+			}}}
+		}
+		res := &post.Post{}
+		err = repo.data.FindOneAndUpdate(ctx, filter, update, opts).Decode(res)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			log.Println("err in update bd in DeleteComment:", err)
+			return nil, err
+		}
+		return res, nil
+	}
+	return nil, ErrCommentConflict
+}
+
+// voteStep is a single conditional update applying a vote to a post in one
+// of the states the post can be in. A nil update only checks the state.
+type voteStep struct {
+	filter bson.M
+	update bson.M
+	opts   *options.UpdateOptions
+}
+
+// maxVoteAttempts bounds the retries of a vote when other requests of the
+// same user change the post between the steps.
+const maxVoteAttempts = 5
+
+// voteCounters is the $inc of the vote counters when a vote of value is
+// added (delta 1) or removed (delta -1).
+func voteCounters(inc bson.M, value, delta int) bson.M {
+	inc["score"] = inc["score"].(int) + value*delta
+	if value == 1 {
+		inc["ups"] = delta
+	} else {
+		inc["downs"] = delta
+	}
+	return inc
+}
+
+func voteSteps(id string, userID int64, coin int) []voteStep {
+	hasNoVote := bson.M{"id": id, "votes.user": bson.M{"$ne": userID}}
+	hasVote := func(value int) bson.M {
+		return bson.M{"id": id, "votes": bson.M{"$elemMatch": bson.M{"user": userID, "vote": value}}}
+	}
+	retract := func(value int) voteStep {
+		return voteStep{
+			filter: hasVote(value),
+			update: bson.M{
+				"$pull": bson.M{"votes": bson.M{"user": userID}},
+				"$inc":  voteCounters(bson.M{"score": 0}, value, -1),
+			},
+		}
+	}
+	if coin == 0 {
+		return []voteStep{retract(1), retract(-1), {filter: hasNoVote}}
+	}
+	return []voteStep{
+		{
+			filter: hasNoVote,
+			update: bson.M{
+				"$push": bson.M{"votes": vote.Vote{User: userID, Vote: coin}},
+				"$inc":  voteCounters(bson.M{"score": 0}, coin, 1),
+			},
+		},
+		retract(coin),
+		{
+			filter: hasVote(-coin),
+			update: bson.M{
+				"$set": bson.M{"votes.$[v].vote": coin},
+				"$inc": voteCounters(voteCounters(bson.M{"score": 0}, -coin, -1), coin, 1),
+			},
+			opts: options.Update().SetArrayFilters(options.ArrayFilters{
+				Filters: []interface{}{bson.M{"v.user": userID}},
+			}),
+		},
+	}
+}
+
+// Vote applies the vote of the user with a conditional update for every
+// state the post may be in: the user has not voted yet, voted the same way
+// or the other way. The update that matches changes the votes and the
+// counters together, so concurrent votes never overwrite each other.
+func (repo *PostMongoRepo) Vote(id string, userID int64, coin int) (*post.Post, error) {
+	ctx := context.TODO()
+	for attempt := 0; attempt < maxVoteAttempts; attempt++ {
+		for _, step := range voteSteps(id, userID, coin) {
+			matched, err := repo.applyVoteStep(ctx, step)
+			if err != nil {
+				log.Println("err in Vote:", err)
+				return nil, err
+			}
+			if matched {
+				return repo.updateRanks(ctx, id)
+			}
+		}
+		if _, err := repo.Get(id); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrVoteConflict
+}
+
+func (repo *PostMongoRepo) applyVoteStep(ctx context.Context, step voteStep) (bool, error) {
+	if step.update == nil {
+		n, err := repo.data.CountDocuments(ctx, step.filter)
+		return n > 0, err
+	}
+	opts := step.opts
+	if opts == nil {
+		opts = options.Update()
+	}
+	res, err := repo.data.UpdateOne(ctx, step.filter, step.update, opts)
 	if err != nil {
-		log.Println("err in update bd in DelateComment:", err)
+		return false, err
 	}
-	return post, nil
+	return res.MatchedCount > 0, nil
 }
 
-func (repo *PostMongoRepo) UpVote(ans *post.Post) (*post.Post, error) {
-	res := repo.data.FindOneAndUpdate(context.TODO(), bson.M{"id": ans.ID}, bson.D{
-		{"$set", bson.M{"votes": ans.Votes, "score": ans.Score, "upvotePercentage": ans.UpvotePercentage}},
+// ranksPipeline recomputes the fields derived from the vote counters inside
+// the database the same way UpdateScore does, so whichever vote finishes
+// last leaves them matching the counters.
+var ranksPipeline = mongo.Pipeline{{{Key: "$set", Value: bson.M{
+	"upvotePercentage": bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$add": bson.A{"$ups", "$downs"}}, 0}},
+		0,
+		bson.M{"$toInt": bson.M{"$floor": bson.M{"$multiply": bson.A{
+			bson.M{"$divide": bson.A{"$ups", bson.M{"$add": bson.A{"$ups", "$downs"}}}},
+			100,
+		}}}},
+	}},
+	"controversy": bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{bson.M{"$gt": bson.A{"$ups", 0}}, bson.M{"$gt": bson.A{"$downs", 0}}}},
+		bson.M{"$pow": bson.A{
+			bson.M{"$add": bson.A{"$ups", "$downs"}},
+			bson.M{"$divide": bson.A{bson.M{"$min": bson.A{"$ups", "$downs"}}, bson.M{"$max": bson.A{"$ups", "$downs"}}}},
+		}},
+		0,
+	}},
+	"hot": bson.M{"$round": bson.A{
+		bson.M{"$add": bson.A{
+			bson.M{"$multiply": bson.A{
+				bson.M{"$cmp": bson.A{"$score", 0}},
+				bson.M{"$log10": bson.M{"$max": bson.A{bson.M{"$abs": "$score"}, 1}}},
+			}},
+			bson.M{"$divide": bson.A{
+				bson.M{"$subtract": bson.A{
+					bson.M{"$divide": bson.A{bson.M{"$toLong": bson.M{"$dateFromString": bson.M{"dateString": "$created"}}}, 1000}},
+					ranking.Epoch,
+				}},
+				45000,
+			}},
+		}},
+		7,
+	}},
+}}}}
+
+func (repo *PostMongoRepo) updateRanks(ctx context.Context, id string) (*post.Post, error) {
+	res := &post.Post{}
+	err := repo.data.FindOneAndUpdate(ctx, bson.M{"id": id}, ranksPipeline,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(res)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPost
+	}
+	if err != nil {
+		log.Println("err in update ranks:", err)
+		return nil, err
+	}
+	return res, nil
+}
+
+// Migrate brings the posts stored by older releases up to date: it turns
+// their creation time into UTC RFC3339 as Add writes it, so the new listing
+// and the period filter compare them right as strings, fills the vote
+// counters and the comment counter, clears the text of deleted comments so
+// the search does not find it, and computes the hot and controversy ranks
+// the listings are sorted by.
+func (repo *PostMongoRepo) Migrate(ctx context.Context) error {
+	_, err := repo.data.UpdateMany(ctx, bson.M{"created": bson.M{"$not": bson.M{"$regex": "Z$"}}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"created": bson.M{"$dateToString": bson.M{
+			"date":     bson.M{"$dateFromString": bson.M{"dateString": "$created"}},
+			"format":   "%Y-%m-%dT%H:%M:%SZ",
+			"timezone": "UTC",
+		}}}}},
 	})
-	if res.Err() != nil {
-		log.Println(res.Err())
-		return nil, res.Err()
+	if err != nil {
+		log.Println("err in migrate created:", err)
+		return err
 	}
-	return ans, nil
+	count := func(value int) bson.M {
+		return bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$votes", bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this.vote", value}},
+		}}}
+	}
+	_, err = repo.data.UpdateMany(ctx, bson.M{"ups": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"ups": count(1), "downs": count(-1)}}},
+	})
+	if err != nil {
+		log.Println("err in migrate votes:", err)
+		return err
+	}
+	_, err = repo.data.UpdateMany(ctx, bson.M{"lastCommentID": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"lastCommentID": bson.M{"$ifNull": bson.A{bson.M{"$max": "$comments.id"}, -1}}}}},
+	})
+	if err != nil {
+		log.Println("err in migrate comments:", err)
+		return err
+	}
+	_, err = repo.data.UpdateMany(ctx,
+		bson.M{"comments": bson.M{"$elemMatch": bson.M{"deleted": true, "body": bson.M{"$ne": ""}}}},
+		bson.M{"$set": bson.M{"comments.$[c].body": ""}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"c.deleted": true}}}),
+	)
+	if err != nil {
+		log.Println("err in migrate deleted comments:", err)
+		return err
+	}
+	_, err = repo.data.UpdateMany(ctx, bson.M{"hot": bson.M{"$exists": false}}, ranksPipeline)
+	if err != nil {
+		log.Println("err in migrate ranks:", err)
+	}
+	return err
 }
 
 func (repo *PostMongoRepo) Delete(id string) (bool, error) {
@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/post"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/user"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCollection is a fresh collection in the database at
+// REDDITCLONE_TEST_MONGO, e.g. mongodb://127.0.0.1:27017, dropped after the
+// test. The test is skipped without it.
+func testCollection(t *testing.T, ctx context.Context) *mongo.Collection {
+	uri := os.Getenv("REDDITCLONE_TEST_MONGO")
+	if uri == "" {
+		t.Skip("REDDITCLONE_TEST_MONGO is not set")
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	collection := client.Database("redditclone_test").Collection(fmt.Sprint("posts_", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		collection.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return collection
+}
+
+func TestMongoLastID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo := NewMongoRepo(testCollection(t, ctx))
+
+	last, err := repo.LastID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), last)
+
+	// deleted posts leave gaps, the count would be 3
+	for _, id := range []string{"9", "10", "62a1f0c2e1b4a0b1c2d3e4f5", "2"} {
+		_, err := repo.Add(&post.Post{ID: id})
+		require.NoError(t, err)
+	}
+	last, err = repo.LastID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), last)
+}
+
+func TestMongoDedupeIDs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := testCollection(t, ctx)
+	repo := NewMongoRepo(collection)
+
+	// posts stored while the ids were counted from the number of posts
+	fixtures := []struct{ oid, id string }{
+		{"000000000000000000000001", "1"},
+		{"000000000000000000000002", "2"},
+		{"000000000000000000000003", "1"},
+		{"000000000000000000000004", "3"},
+		{"000000000000000000000005", "1"},
+		{"000000000000000000000006", "3"},
+	}
+	for _, f := range fixtures {
+		oid, err := primitive.ObjectIDFromHex(f.oid)
+		require.NoError(t, err)
+		_, err = collection.InsertOne(ctx, bson.M{"_id": oid, "id": f.id})
+		require.NoError(t, err)
+	}
+	assert.Error(t, repo.EnsureIndexes(ctx))
+
+	last, err := repo.LastID(ctx)
+	require.NoError(t, err)
+	n, err := repo.DedupeIDs(ctx, idgen.NewSequence(last))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	require.NoError(t, repo.EnsureIndexes(ctx))
+
+	got := map[string]string{}
+	cur, err := collection.Find(ctx, bson.M{})
+	require.NoError(t, err)
+	var docs []struct {
+		OID primitive.ObjectID `bson:"_id"`
+		ID  string             `bson:"id"`
+	}
+	require.NoError(t, cur.All(ctx, &docs))
+	for _, doc := range docs {
+		got[doc.OID.Hex()] = doc.ID
+	}
+	// the oldest posts keep their ids, the others go after the last one
+	assert.Equal(t, "1", got["000000000000000000000001"])
+	assert.Equal(t, "2", got["000000000000000000000002"])
+	assert.Equal(t, "3", got["000000000000000000000004"])
+	assert.ElementsMatch(t, []string{"4", "5", "6"}, []string{
+		got["000000000000000000000003"], got["000000000000000000000005"], got["000000000000000000000006"],
+	})
+
+	// with the index in place the posts are not scanned again
+	n, err = repo.DedupeIDs(ctx, idgen.NewSequence(0))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestMongoUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo := NewMongoRepo(testCollection(t, ctx))
+	require.NoError(t, repo.EnsureIndexes(ctx))
+	DB := NewPostDB(repo, idgen.NewSequence(0))
+	author := &user.User{ID: 3, Login: "arin0"}
+	p, err := DB.Add(&post.Post{Author: *author, Category: "music", Type: "text", Title: "hello"})
+	require.NoError(t, err)
+
+	title := "hello again"
+	_, err = DB.Update(p.ID, &post.Changes{Title: &title}, author)
+	require.NoError(t, err)
+	stored, err := repo.Get(p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, title, stored.Title)
+	assert.NotEmpty(t, stored.Updated)
+
+	// the post was deleted between the read and the write
+	_, err = repo.Update(&post.Post{ID: "42", Title: title})
+	assert.Equal(t, ErrNoPost, err)
+}
+
+func TestMongoEditComment(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo := NewMongoRepo(testCollection(t, ctx))
+	require.NoError(t, repo.EnsureIndexes(ctx))
+	DB := NewPostDB(repo, idgen.NewSequence(0))
+	author := &user.User{ID: 3, Login: "arin0"}
+	p, err := DB.Add(&post.Post{Author: *author, Category: "music", Type: "text", Title: "hello"})
+	require.NoError(t, err)
+	_, err = DB.AddComment(p.ID, "first", author)
+	require.NoError(t, err)
+	_, err = DB.AddReply(p.ID, 0, "reply", author)
+	require.NoError(t, err)
+
+	res, err := DB.EditComment(p.ID, 0, "first edited", author)
+	require.NoError(t, err)
+	assert.Equal(t, "first edited", res.Comments[0].Body)
+	assert.NotEmpty(t, res.Comments[0].Edited)
+	assert.Equal(t, []comment.Revision{{Body: "first", Created: res.Comments[0].Created}}, res.Comments[0].History)
+	assert.Equal(t, "reply", res.Comments[1].Body, "the other comments are left alone")
+
+	_, err = DB.EditComment(p.ID, 0, "not mine", &user.User{ID: 4, Login: "other"})
+	assert.Equal(t, comment.ErrNotAuthor, err)
+	_, err = DB.EditComment(p.ID, 42, "nowhere", author)
+	assert.Equal(t, comment.ErrNoComment, err)
+	_, err = DB.DeleteComment(p.ID, 0)
+	require.NoError(t, err)
+	_, err = DB.EditComment(p.ID, 0, "deleted", author)
+	assert.Equal(t, comment.ErrNoComment, err)
+
+	// concurrent edits each leave one revision
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := DB.EditComment(p.ID, 1, fmt.Sprint("reply ", i), author)
+			assert.True(t, err == nil || err == ErrCommentConflict, "%v", err)
+		}(i)
+	}
+	wg.Wait()
+	res, err = DB.Get(p.ID)
+	require.NoError(t, err)
+	seen := map[string]bool{}
+	for _, rev := range res.Comments[1].History {
+		assert.False(t, seen[rev.Body], "%s is in the history twice", rev.Body)
+		seen[rev.Body] = true
+	}
+	assert.False(t, seen[res.Comments[1].Body])
+}
+
+func TestMongoMigrate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	collection := testCollection(t, ctx)
+	repo := NewMongoRepo(collection)
+
+	// posts of the first release: local times, no counters and no ranks
+	legacy := []bson.M{
+		{"id": "1", "category": "music", "created": "2022-05-10T13:31:10+03:00", "score": 1,
+			"votes": bson.A{bson.M{"user": 3, "vote": 1}},
+			"comments": bson.A{
+				bson.M{"id": 0, "body": "[deleted]", "deleted": true},
+				bson.M{"id": 4, "body": "second", "parentID": 0},
+			}},
+		{"id": "2", "category": "music", "created": "2022-05-10T11:00:00+00:00", "score": 0,
+			"votes":    bson.A{bson.M{"user": 3, "vote": 1}, bson.M{"user": 4, "vote": -1}},
+			"comments": bson.A{}},
+	}
+	for _, doc := range legacy {
+		_, err := collection.InsertOne(ctx, doc)
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.EnsureIndexes(ctx))
+	require.NoError(t, repo.Migrate(ctx))
+
+	first, err := repo.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, "2022-05-10T10:31:10Z", first.Created)
+	assert.Equal(t, 1, first.Ups)
+	assert.Equal(t, 0, first.Downs)
+	assert.Equal(t, int64(4), first.LastCommentID)
+	assert.Empty(t, first.Comments[0].Body)
+	assert.Equal(t, "second", first.Comments[1].Body)
+	created, _ := time.Parse(time.RFC3339, first.Created)
+	assert.InDelta(t, ranking.HotScore(1, created), first.Hot, 1e-6)
+
+	second, err := repo.Get("2")
+	require.NoError(t, err)
+	assert.Equal(t, "2022-05-10T11:00:00Z", second.Created)
+	assert.Equal(t, int64(-1), second.LastCommentID)
+	assert.Equal(t, ranking.Controversy(1, 1), second.Controversy)
+
+	// both are listed in every order now, the newer one first
+	for _, s := range []ranking.Sort{ranking.Hot, ranking.New, ranking.Controversial} {
+		posts, err := repo.Find(ctx, post.Filter{}, post.Page{Sort: s, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, posts, 1)
+		next, err := repo.Find(ctx, post.Filter{}, post.Page{Sort: s, After: posts[0].ID})
+		require.NoError(t, err)
+		assert.Len(t, next, 1, "sort %s", s)
+	}
+	posts, err := repo.Find(ctx, post.Filter{}, post.Page{Sort: ranking.New})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "1"}, ids(posts))
+
+	// a second run changes nothing
+	require.NoError(t, repo.Migrate(ctx))
+	again, err := repo.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+}
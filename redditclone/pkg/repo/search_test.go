@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+)
+
+// testSearchDeleted deletes a comment that still has replies and checks that
+// its text is found by neither the words it had nor the placeholder shown
+// in its place.
+func testSearchDeleted(t *testing.T, data post.PostDataFunctional) {
+	author := &user.User{ID: 1000, Login: "arin0"}
+	DB := NewPostDB(data, idgen.NewSequence(0))
+	p, err := DB.Add(&post.Post{Author: *author, Category: "music", Type: "text", Title: "tombstone"})
+	require.NoError(t, err)
+	p, err = DB.AddComment(p.ID, "secret words", author)
+	require.NoError(t, err)
+	root := p.Comments[0].ID
+	_, err = DB.AddReply(p.ID, root, "an answer", author)
+	require.NoError(t, err)
+
+	found, err := DB.Search("secret", post.Filter{}, 10)
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	p, err = DB.DeleteComment(p.ID, root)
+	require.NoError(t, err)
+	require.True(t, p.Comments[0].Deleted)
+	assert.Empty(t, p.Comments[0].Body)
+
+	for _, text := range []string{"secret", "deleted"} {
+		found, err = DB.Search(text, post.Filter{}, 10)
+		require.NoError(t, err)
+		assert.Empty(t, found, "search %q", text)
+	}
+	found, err = DB.Search("answer", post.Filter{}, 10)
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+}
+
+func TestMemorySearchDeleted(t *testing.T) {
+	testSearchDeleted(t, NewPostMemoryRepo())
+}
+
+func TestMongoSearchDeleted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo := NewMongoRepo(testCollection(t, ctx))
+	require.NoError(t, repo.EnsureIndexes(ctx))
+	testSearchDeleted(t, repo)
+}
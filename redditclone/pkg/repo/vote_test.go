@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/idgen"
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConcurrentVotes has hundreds of users voting on one post at the same
+// time, some of them changing or taking back their votes, and checks that no
+// vote got lost.
+func testConcurrentVotes(t *testing.T, data post.PostDataFunctional) {
+	const voters = 300
+	DB := NewPostDB(data, idgen.NewSequence(0))
+	p, err := DB.Add(&post.Post{Author: user.User{ID: 1000, Login: "arin0"}, Category: "music", Type: "text", Title: "vote"})
+	assert.NoError(t, err)
+
+	final := make(map[int64]int)
+	var wg sync.WaitGroup
+	for i := 0; i < voters; i++ {
+		u := &user.User{ID: int64(i), Login: fmt.Sprint("user", i)}
+		coins := []int{1}
+		if i%3 == 0 {
+			coins = []int{-1}
+		}
+		if i%5 == 0 {
+			coins = append(coins, -coins[0])
+		}
+		if i%7 == 0 {
+			coins = append(coins, 0)
+		}
+		if last := coins[len(coins)-1]; last != 0 {
+			final[u.ID] = last
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, coin := range coins {
+				_, err := DB.UpdateVote(coin, p.ID, u)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	res, err := DB.Get(p.ID)
+	assert.NoError(t, err)
+	score, ups := 0, 0
+	for _, coin := range final {
+		score += coin
+		if coin == 1 {
+			ups++
+		}
+	}
+	assert.Len(t, res.Votes, len(final))
+	for _, v := range res.Votes {
+		assert.Equal(t, final[v.User], v.Vote)
+	}
+	assert.Equal(t, score, res.Score)
+	assert.Equal(t, ups, res.Ups)
+	assert.Equal(t, len(final)-ups, res.Downs)
+	assert.Equal(t, ups*100/len(final), res.UpvotePercentage)
+}
+
+func TestMemoryConcurrentVotes(t *testing.T) {
+	testConcurrentVotes(t, NewPostMemoryRepo())
+}
+
+func TestMongoConcurrentVotes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo := NewMongoRepo(testCollection(t, ctx))
+	assert.NoError(t, repo.EnsureIndexes(ctx))
+	testConcurrentVotes(t, repo)
+}
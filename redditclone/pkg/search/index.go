@@ -0,0 +1,118 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Field is a piece of text of a document, matches in fields with a bigger
+// Weight rank higher.
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+// Hit is a document matching a query with its relevance.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index is an in-memory inverted index from words to the documents they
+// appear in. It is safe for concurrent use.
+type Index struct {
+	mutex sync.RWMutex
+	// postings maps a word to the weighted number of its occurrences in
+	// every document containing it.
+	postings map[string]map[string]float64
+	// words keeps the words of every document to remove it later.
+	words map[string][]string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]float64),
+		words:    make(map[string][]string),
+	}
+}
+
+// Tokenize splits text into lower case words of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Add indexes the document id, replacing what was indexed for it before.
+func (idx *Index) Add(id string, fields ...Field) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.remove(id)
+	for _, f := range fields {
+		for _, word := range Tokenize(f.Text) {
+			docs, ok := idx.postings[word]
+			if !ok {
+				docs = make(map[string]float64)
+				idx.postings[word] = docs
+			}
+			if _, seen := docs[id]; !seen {
+				idx.words[id] = append(idx.words[id], word)
+			}
+			docs[id] += f.Weight
+		}
+	}
+}
+
+func (idx *Index) Remove(id string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	for _, word := range idx.words[id] {
+		delete(idx.postings[word], id)
+		if len(idx.postings[word]) == 0 {
+			delete(idx.postings, word)
+		}
+	}
+	delete(idx.words, id)
+}
+
+// Search returns the documents containing any word of the query, the most
+// relevant first. A document scores the weighted count of every query word
+// in it multiplied by how rare the word is.
+func (idx *Index) Search(query string) []Hit {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, word := range Tokenize(query) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		docs := idx.postings[word]
+		if len(docs) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(len(idx.words))/float64(len(docs)))
+		for id, tf := range docs {
+			scores[id] += tf * idf
+		}
+	}
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
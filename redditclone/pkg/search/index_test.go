@@ -0,0 +1,39 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func ids(hits []Hit) []string {
+	res := make([]string, 0, len(hits))
+	for _, h := range hits {
+		res = append(res, h.ID)
+	}
+	return res
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"go", "1", "18", "привет", "мир"}, Tokenize("Go 1.18: Привет, мир!"))
+	assert.Empty(t, Tokenize(" ,.- "))
+}
+
+func TestSearch(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("1", Field{Text: "Learning Go", Weight: 3}, Field{Text: "channels and goroutines", Weight: 1})
+	idx.Add("2", Field{Text: "Music of the week", Weight: 3}, Field{Text: "go listen to it", Weight: 1})
+	idx.Add("3", Field{Text: "Cooking", Weight: 3})
+
+	assert.Equal(t, []string{"1", "2"}, ids(idx.Search("go")))
+	assert.Equal(t, []string{"2", "1"}, ids(idx.Search("MUSIC go")))
+	assert.Empty(t, idx.Search("rust"))
+	assert.Empty(t, idx.Search(""))
+
+	idx.Add("1", Field{Text: "Learning Rust", Weight: 3})
+	assert.Equal(t, []string{"2"}, ids(idx.Search("go")))
+	assert.Equal(t, []string{"1"}, ids(idx.Search("rust")))
+
+	idx.Remove("2")
+	assert.Empty(t, idx.Search("go"))
+	assert.Empty(t, idx.Search("music"))
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long in-flight requests are waited for when
+// the server stops.
+const DefaultShutdownTimeout = 15 * time.Second
+
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// Server runs HTTP until its context is cancelled and then shuts down: it
+// reports Draining for the health endpoints, keeps serving for DrainDelay so
+// the load balancer sees the server is not ready and stops sending requests,
+// waits for in-flight requests up to ShutdownTimeout and then releases the
+// resources registered with OnShutdown in the order they were registered.
+type Server struct {
+	HTTP            *http.Server
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+	Logger          *zap.SugaredLogger
+
+	mutex    sync.Mutex
+	closers  []closer
+	draining int32
+}
+
+// OnShutdown registers close to be called after the requests are drained.
+func (s *Server) OnShutdown(name string, close func(ctx context.Context) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+// Draining reports whether the server is shutting down.
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Run listens on HTTP.Addr and serves until ctx is done, see Serve.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.HTTP.Addr)
+	if err != nil {
+		s.close()
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is done or the server fails and then shuts
+// down. The resources are released in both cases.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	errServe := make(chan error, 1)
+	go func() {
+		errServe <- s.HTTP.Serve(ln)
+	}()
+
+	var err error
+	select {
+	case err = <-errServe:
+		s.Logger.Errorw("server stopped", "err", err)
+	case <-ctx.Done():
+		s.Logger.Infow("shutting down", "delay", s.DrainDelay, "timeout", s.ShutdownTimeout)
+		err = s.drain(errServe)
+	}
+	s.close()
+	return err
+}
+
+func (s *Server) drain(errServe <-chan error) error {
+	atomic.StoreInt32(&s.draining, 1)
+	if s.DrainDelay > 0 {
+		timer := time.NewTimer(s.DrainDelay)
+		select {
+		case <-timer.C:
+		case err := <-errServe:
+			timer.Stop()
+			s.Logger.Errorw("server stopped", "err", err)
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+	err := s.HTTP.Shutdown(ctx)
+	if err != nil {
+		s.Logger.Errorw("requests were not drained", "err", err)
+		return err
+	}
+	s.Logger.Infow("requests drained")
+	return nil
+}
+
+// close calls the closers one by one, each of them gets its own deadline so
+// that a slow drain does not leave the databases without a disconnect.
+func (s *Server) close() {
+	atomic.StoreInt32(&s.draining, 1)
+	s.mutex.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.mutex.Unlock()
+	for _, c := range closers {
+		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+		err := c.close(ctx)
+		cancel()
+		if err != nil {
+			s.Logger.Errorw("error on shutdown", "resource", c.name, "err", err)
+		}
+	}
+}
+
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.ShutdownTimeout <= 0 {
+		return DefaultShutdownTimeout
+	}
+	return s.ShutdownTimeout
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, handler http.Handler, timeout time.Duration) (*Server, net.Listener, *[]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		HTTP:            &http.Server{Handler: handler},
+		ShutdownTimeout: timeout,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	var closed []string
+	for _, name := range []string{"mongo", "mysql", "logger"} {
+		name := name
+		srv.OnShutdown(name, func(ctx context.Context) error {
+			closed = append(closed, name)
+			return nil
+		})
+	}
+	return srv, ln, &closed
+}
+
+func TestServeDrains(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	srv, ln, closed := newTestServer(t, handler, time.Second)
+
+	assert.False(t, srv.Draining())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- srv.Serve(ctx, ln) }()
+
+	resp := make(chan int)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			resp <- 0
+			return
+		}
+		res.Body.Close()
+		resp <- res.StatusCode
+	}()
+	<-entered
+	cancel()
+
+	for !srv.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Empty(t, *closed, "closed before the request finished")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-resp)
+	assert.NoError(t, <-served)
+	assert.Equal(t, []string{"mongo", "mysql", "logger"}, *closed)
+}
+
+func TestServeDrainDeadline(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+	srv, ln, closed := newTestServer(t, handler, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- srv.Serve(ctx, ln) }()
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-entered
+	cancel()
+
+	assert.ErrorIs(t, <-served, context.DeadlineExceeded)
+	assert.Equal(t, []string{"mongo", "mysql", "logger"}, *closed, "resources are released after the deadline")
+}
+
+func TestServeDrainDelay(t *testing.T) {
+	var srv *Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if srv.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	srv, ln, closed := newTestServer(t, mux, time.Second)
+	srv.DrainDelay = 200 * time.Millisecond
+	ready := func() int {
+		res, err := http.Get("http://" + ln.Addr().String() + "/ready")
+		if err != nil {
+			return 0
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- srv.Serve(ctx, ln) }()
+	assert.Equal(t, http.StatusOK, ready())
+
+	stopped := time.Now()
+	cancel()
+	for !srv.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	// still serving during the delay, only not ready
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+	assert.Empty(t, *closed)
+
+	assert.NoError(t, <-served)
+	assert.GreaterOrEqual(t, time.Since(stopped), srv.DrainDelay)
+	assert.Equal(t, 0, ready(), "the listener is closed after the delay")
+	assert.Equal(t, []string{"mongo", "mysql", "logger"}, *closed)
+}
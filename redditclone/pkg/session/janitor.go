@@ -0,0 +1,108 @@
+package session
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCleanupInterval = 10 * time.Minute
+	DefaultCleanupBatch    = 500
+	// purgeTimeout bounds one batch, a stuck query is given up until the
+	// next round.
+	purgeTimeout = 30 * time.Second
+)
+
+// Purger deletes expired sessions in batches, see
+// SessionsManager.PurgeExpired.
+type Purger interface {
+	PurgeExpired(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+// Janitor deletes the expired sessions every Interval, Batch rows at a time
+// so that a large backlog does not lock the table for long. Expired sessions
+// are already refused by the repo, the janitor only frees the space.
+type Janitor struct {
+	Repo     Purger
+	Interval time.Duration
+	Batch    int
+	Logger   *zap.SugaredLogger
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start runs the janitor in the background until Stop, the first round runs
+// right away.
+func (j *Janitor) Start() {
+	if j.Interval <= 0 {
+		j.Interval = DefaultCleanupInterval
+	}
+	if j.Batch <= 0 {
+		j.Batch = DefaultCleanupBatch
+	}
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	go j.run()
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		j.purge(time.Now())
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge deletes batches until one comes back short. A stop is noticed
+// between the batches, the one in flight is finished.
+func (j *Janitor) purge(now time.Time) {
+	total := 0
+	for {
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+		n, err := j.Repo.PurgeExpired(ctx, now, j.Batch)
+		cancel()
+		total += n
+		if err != nil {
+			j.Logger.Errorw("cant purge expired sessions", "purged", total, "err", err)
+			return
+		}
+		if n < j.Batch {
+			break
+		}
+	}
+	if total > 0 {
+		j.Logger.Infow("purged expired sessions", "purged", total)
+	}
+}
+
+// Stop asks the janitor to stop and waits for the batch in flight, ctx bounds
+// the wait. It fits server.OnShutdown.
+func (j *Janitor) Stop(ctx context.Context) error {
+	if j.done == nil {
+		return nil
+	}
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
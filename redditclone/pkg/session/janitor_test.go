@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePurger has expired sessions to delete and records the batches.
+type fakePurger struct {
+	mutex   sync.Mutex
+	expired int
+	batches []int
+	err     error
+	block   chan struct{}
+	called  chan struct{}
+}
+
+func (p *fakePurger) PurgeExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	if p.called != nil {
+		p.called <- struct{}{}
+	}
+	if p.block != nil {
+		<-p.block
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err != nil {
+		return 0, p.err
+	}
+	n := limit
+	if p.expired < n {
+		n = p.expired
+	}
+	p.expired -= n
+	p.batches = append(p.batches, n)
+	return n, nil
+}
+
+func TestJanitorBatches(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	repo := &fakePurger{expired: 25}
+	j := &Janitor{Repo: repo, Batch: 10, Logger: zap.New(core).Sugar()}
+	j.purge(time.Now())
+	assert.Equal(t, []int{10, 10, 5}, repo.batches)
+	assert.Equal(t, 1, logs.FilterMessage("purged expired sessions").FilterField(zap.Int("purged", 25)).Len())
+
+	// nothing to delete, nothing to log
+	j.purge(time.Now())
+	assert.Equal(t, []int{10, 10, 5, 0}, repo.batches)
+	assert.Equal(t, 1, logs.Len())
+
+	repo.err = fmt.Errorf("connection refused")
+	j.purge(time.Now())
+	assert.Equal(t, 1, logs.FilterMessage("cant purge expired sessions").Len())
+}
+
+func TestJanitorStop(t *testing.T) {
+	repo := &fakePurger{expired: 3, called: make(chan struct{}, 10)}
+	j := &Janitor{Repo: repo, Interval: time.Hour, Batch: 10, Logger: zap.NewNop().Sugar()}
+	j.Start()
+	<-repo.called // the first round runs right away
+	assert.NoError(t, j.Stop(context.Background()))
+	assert.NoError(t, j.Stop(context.Background()))
+
+	// the batch in flight is waited for until the deadline
+	repo = &fakePurger{expired: 3, called: make(chan struct{}, 10), block: make(chan struct{})}
+	j = &Janitor{Repo: repo, Interval: time.Hour, Batch: 10, Logger: zap.NewNop().Sugar()}
+	j.Start()
+	<-repo.called
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, j.Stop(ctx))
+	close(repo.block)
+	assert.NoError(t, j.Stop(context.Background()))
+
+	// never started
+	assert.NoError(t, (&Janitor{}).Stop(context.Background()))
+}
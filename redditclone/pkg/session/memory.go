@@ -0,0 +1,179 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemorySessions keeps the sessions in memory, they are lost on restart. The
+// expired ones are deleted by a Janitor through PurgeExpired. Sessions go in
+// and out as copies so callers never share them with the storage.
+type MemorySessions struct {
+	data     map[string]*memorySession
+	seq      int64
+	mutex    sync.Mutex
+	Timeouts Timeouts
+}
+
+// memorySession remembers the order of creation, List breaks ties of
+// Created with it like the MySQL repo does with the row id.
+type memorySession struct {
+	Session
+	seq int64
+}
+
+func NewMemorySessions() *MemorySessions {
+	return &MemorySessions{data: make(map[string]*memorySession)}
+}
+
+func (ms *MemorySessions) copyOf(stored *memorySession) *Session {
+	sess := stored.Session
+	return &sess
+}
+
+// Check finds the session of the cookie, see Get.
+func (ms *MemorySessions) Check(r *http.Request) (*Session, error) {
+	sessionCookie, err := r.Cookie("session_id")
+	if err == http.ErrNoCookie {
+		return nil, ErrNoAuth
+	}
+	return ms.Get(sessionCookie.Value)
+}
+
+func (ms *MemorySessions) Create(w http.ResponseWriter, userID int64, client Client) (*Session, error) {
+	sess := NewSession(userID, client)
+	sess.Expires = ms.Timeouts.Deadline(sess.Created, sess.LastSeen)
+
+	ms.mutex.Lock()
+	ms.seq++
+	stored := &memorySession{Session: *sess, seq: ms.seq}
+	// the refresh token itself is only given to the client
+	stored.RefreshToken = ""
+	ms.data[sess.ID] = stored
+	ms.mutex.Unlock()
+
+	SetCookie(w, sess, sess.Created.Add(ms.Timeouts.maxAge()))
+	return sess, nil
+}
+
+// Get returns the session while it is within its timeouts and slides its
+// expiry, an expired session is deleted on the spot.
+func (ms *MemorySessions) Get(id string) (*Session, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.get(id, time.Now())
+}
+
+// get must be called with the mutex locked.
+func (ms *MemorySessions) get(id string, now time.Time) (*Session, error) {
+	stored, ok := ms.data[id]
+	if !ok {
+		return nil, ErrNoAuth
+	}
+	if ms.Timeouts.Expired(&stored.Session, now) {
+		delete(ms.data, id)
+		return nil, ErrNoAuth
+	}
+	ms.Timeouts.Touch(&stored.Session, now)
+	return ms.copyOf(stored), nil
+}
+
+// Refresh checks and rotates the token under one lock, of two concurrent
+// refreshes with the same token only the first one succeeds.
+func (ms *MemorySessions) Refresh(token string) (*Session, error) {
+	id, err := SessionOfRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	sess, err := ms.get(id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !SameRefreshHash(sess.RefreshHash, token) {
+		delete(ms.data, id)
+		return nil, ErrRefreshReused
+	}
+	newToken, newHash := NewRefreshToken(id)
+	ms.data[id].RefreshHash = newHash
+	sess.RefreshHash, sess.RefreshToken = newHash, newToken
+	return sess, nil
+}
+
+func (ms *MemorySessions) DestroyCurrent(w http.ResponseWriter, r *http.Request) error {
+	sess, err := SessionFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	delete(ms.data, sess.ID)
+	ms.mutex.Unlock()
+	ClearCookie(w)
+	return nil
+}
+
+func (ms *MemorySessions) Destroy(id string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.data[id]; !ok {
+		return ErrNoSession
+	}
+	delete(ms.data, id)
+	return nil
+}
+
+func (ms *MemorySessions) DestroyAll(userID int64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	for id, stored := range ms.data {
+		if stored.UserID == userID {
+			delete(ms.data, id)
+		}
+	}
+	return nil
+}
+
+func (ms *MemorySessions) List(userID int64) ([]*Session, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	now := time.Now()
+	var found []*memorySession
+	for _, stored := range ms.data {
+		if stored.UserID == userID && !ms.Timeouts.Expired(&stored.Session, now) {
+			found = append(found, stored)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].Created.Equal(found[j].Created) {
+			return found[i].Created.After(found[j].Created)
+		}
+		return found[i].seq > found[j].seq
+	})
+	res := make([]*Session, 0, len(found))
+	for _, stored := range found {
+		res = append(res, ms.copyOf(stored))
+	}
+	return res, nil
+}
+
+// PurgeExpired deletes up to limit sessions that expired before now and
+// returns how many it deleted, see Janitor.
+func (ms *MemorySessions) PurgeExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	n := 0
+	for id, stored := range ms.data {
+		if n == limit {
+			break
+		}
+		if ms.Timeouts.Expired(&stored.Session, now) {
+			delete(ms.data, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCreateListDestroy(t *testing.T) {
+	ms := NewMemorySessions()
+	w := httptest.NewRecorder()
+	first, err := ms.Create(w, 3, Client{UserAgent: "first", IP: "1.2.3.4"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Set-Cookie"), "session_id="+first.ID))
+	second, err := ms.Create(httptest.NewRecorder(), 3, Client{UserAgent: "second"})
+	require.NoError(t, err)
+	other, err := ms.Create(httptest.NewRecorder(), 4, Client{})
+	require.NoError(t, err)
+
+	got, err := ms.Get(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "first", got.UserAgent)
+	assert.Equal(t, "1.2.3.4", got.IP)
+	assert.Empty(t, got.RefreshToken)
+	// the copy does not change the stored session
+	got.UserID = 4
+	got, _ = ms.Get(first.ID)
+	assert.Equal(t, int64(3), got.UserID)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "session_id="+second.ID)
+	got, err = ms.Check(req)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, got.ID)
+
+	list, err := ms.List(3)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	// created within the same second, the later one goes first
+	assert.Equal(t, "second", list[0].UserAgent)
+
+	assert.NoError(t, ms.Destroy(first.ID))
+	assert.Equal(t, ErrNoSession, ms.Destroy(first.ID))
+	_, err = ms.Get(first.ID)
+	assert.Equal(t, ErrNoAuth, err)
+
+	assert.NoError(t, ms.DestroyAll(3))
+	list, err = ms.List(3)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	_, err = ms.Get(other.ID)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/api/logout", nil)
+	req = req.WithContext(NewContext(req.Context(), other))
+	w = httptest.NewRecorder()
+	assert.NoError(t, ms.DestroyCurrent(w, req))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session_id=;")
+	_, err = ms.Get(other.ID)
+	assert.Equal(t, ErrNoAuth, err)
+}
+
+func TestMemoryRefresh(t *testing.T) {
+	ms := NewMemorySessions()
+	sess, err := ms.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+
+	rotated, err := ms.Refresh(sess.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, sess.RefreshToken, rotated.RefreshToken)
+	assert.True(t, SameRefreshHash(rotated.RefreshHash, rotated.RefreshToken))
+
+	// the old token destroys the session
+	_, err = ms.Refresh(sess.RefreshToken)
+	assert.Equal(t, ErrRefreshReused, err)
+	_, err = ms.Refresh(rotated.RefreshToken)
+	assert.Equal(t, ErrNoAuth, err)
+
+	// of concurrent refreshes with the same token one wins
+	sess, err = ms.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := map[error]int{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ms.Refresh(sess.RefreshToken)
+			mu.Lock()
+			results[err]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, results[nil])
+	assert.Equal(t, 1, results[ErrRefreshReused])
+	assert.Equal(t, 8, results[ErrNoAuth])
+}
+
+func TestMemoryTimeouts(t *testing.T) {
+	ms := NewMemorySessions()
+	ms.Timeouts = Timeouts{MaxAge: time.Hour, IdleTimeout: 10 * time.Minute}
+	sess, err := ms.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+	stale, err := ms.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+
+	// seen long ago, the expiry slides on the next request
+	ms.data[sess.ID].LastSeen = time.Now().Add(-5 * time.Minute).Truncate(time.Second)
+	got, err := ms.Get(sess.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), got.Expires, 2*time.Second)
+	assert.Equal(t, got.Expires, ms.data[sess.ID].Expires)
+
+	ms.data[stale.ID].Expires = time.Now().Add(-time.Second)
+	list, err := ms.List(3)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	_, err = ms.Get(stale.ID)
+	assert.Equal(t, ErrNoAuth, err)
+	assert.NotContains(t, ms.data, stale.ID)
+
+	// the janitor deletes the sessions nobody asks for
+	for i := 0; i < 3; i++ {
+		s, _ := ms.Create(httptest.NewRecorder(), 4, Client{})
+		ms.data[s.ID].Expires = time.Now().Add(-time.Second)
+	}
+	n, err := ms.PurgeExpired(context.Background(), time.Now(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, _ = ms.PurgeExpired(context.Background(), time.Now(), 2)
+	assert.Equal(t, 1, n)
+	assert.Len(t, ms.data, 1)
+}
@@ -0,0 +1,268 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RedisSessions keeps the sessions in Redis. Every session is a hash that
+// Redis deletes itself when the session expires, so no janitor is needed, and
+// the IDs of the sessions of a user are kept in a set for List and DestroyAll.
+type RedisSessions struct {
+	client   *redis.Client
+	Timeouts Timeouts
+}
+
+func NewRedisSessions(client *redis.Client) *RedisSessions {
+	return &RedisSessions{client: client}
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID int64) string {
+	return "user_sessions:" + strconv.FormatInt(userID, 10)
+}
+
+// touchScript slides the expiry of a session that still exists, a plain HSET
+// would bring back a session destroyed in the meantime.
+var touchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'last_seen', ARGV[1], 'expires', ARGV[2])
+redis.call('EXPIREAT', KEYS[1], ARGV[2])
+return 1
+`)
+
+// rotateScript replaces the refresh hash only if it is still the one that was
+// read, two concurrent refreshes with the same token rotate it only once.
+var rotateScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'refresh') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'refresh', ARGV[2])
+return 1
+`)
+
+// destroyAllScript deletes the sessions in the set of the user and the set
+// itself at once, a session created in between can not be left behind in a
+// deleted set.
+var destroyAllScript = redis.NewScript(`
+for _, id in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	redis.call('DEL', ARGV[1] .. id)
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// Check finds the session of the cookie, see Get.
+func (rs *RedisSessions) Check(r *http.Request) (*Session, error) {
+	sessionCookie, err := r.Cookie("session_id")
+	if err == http.ErrNoCookie {
+		return nil, ErrNoAuth
+	}
+	return rs.Get(sessionCookie.Value)
+}
+
+func (rs *RedisSessions) Create(w http.ResponseWriter, userID int64, client Client) (*Session, error) {
+	sess := NewSession(userID, client)
+	sess.Expires = rs.Timeouts.Deadline(sess.Created, sess.LastSeen)
+	maxAge := sess.Created.Add(rs.Timeouts.maxAge())
+
+	ctx := context.Background()
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKey(sess.ID),
+			"user", sess.UserID,
+			"refresh", sess.RefreshHash,
+			"created", sess.Created.Unix(),
+			"user_agent", sess.UserAgent,
+			"ip", sess.IP,
+			"last_seen", sess.LastSeen.Unix(),
+			"expires", sess.Expires.Unix(),
+		)
+		pipe.ExpireAt(ctx, sessionKey(sess.ID), sess.Expires)
+		pipe.SAdd(ctx, userSessionsKey(userID), sess.ID)
+		// the newest session ends last, the set outlives all its members
+		pipe.ExpireAt(ctx, userSessionsKey(userID), maxAge)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	SetCookie(w, sess, maxAge)
+	return sess, nil
+}
+
+// parseSession reads the hash written by Create, an empty hash is a missing
+// session.
+func parseSession(id string, fields map[string]string) (*Session, error) {
+	if len(fields) == 0 {
+		return nil, ErrNoAuth
+	}
+	sess := &Session{
+		ID:          id,
+		RefreshHash: fields["refresh"],
+		UserAgent:   fields["user_agent"],
+		IP:          fields["ip"],
+	}
+	var err error
+	if sess.UserID, err = strconv.ParseInt(fields["user"], 10, 64); err != nil {
+		return nil, fmt.Errorf("session %s: bad user: %w", sess.PublicID(), err)
+	}
+	for name, dst := range map[string]*time.Time{"created": &sess.Created, "last_seen": &sess.LastSeen, "expires": &sess.Expires} {
+		unix, errT := strconv.ParseInt(fields[name], 10, 64)
+		if errT != nil {
+			return nil, fmt.Errorf("session %s: bad %s: %w", sess.PublicID(), name, errT)
+		}
+		*dst = time.Unix(unix, 0)
+	}
+	return sess, nil
+}
+
+// Get returns the session while it is within its timeouts and slides its
+// expiry. Redis drops an expired session by itself, one whose timeouts were
+// shortened since it was stored is deleted on the spot.
+func (rs *RedisSessions) Get(id string) (*Session, error) {
+	ctx := context.Background()
+	fields, err := rs.client.HGetAll(ctx, sessionKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sess, err := parseSession(id, fields)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if rs.Timeouts.Expired(sess, now) {
+		if errD := rs.remove(ctx, sess); errD != nil {
+			return nil, errD
+		}
+		return nil, ErrNoAuth
+	}
+	if rs.Timeouts.Touch(sess, now) {
+		// a failed write only leaves the old expiry in place
+		_ = touchScript.Run(ctx, rs.client, []string{sessionKey(id)}, sess.LastSeen.Unix(), sess.Expires.Unix()).Err()
+	}
+	return sess, nil
+}
+
+func (rs *RedisSessions) Refresh(token string) (*Session, error) {
+	id, err := SessionOfRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := rs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if !SameRefreshHash(sess.RefreshHash, token) {
+		if errD := rs.remove(ctx, sess); errD != nil {
+			return nil, errD
+		}
+		return nil, ErrRefreshReused
+	}
+	newToken, newHash := NewRefreshToken(id)
+	rotated, err := rotateScript.Run(ctx, rs.client, []string{sessionKey(id)}, sess.RefreshHash, newHash).Int()
+	if err != nil {
+		return nil, err
+	}
+	if rotated == 0 {
+		return nil, ErrRefreshReused
+	}
+	sess.RefreshHash, sess.RefreshToken = newHash, newToken
+	return sess, nil
+}
+
+// remove deletes the session and takes it out of the set of its user.
+func (rs *RedisSessions) remove(ctx context.Context, sess *Session) error {
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(sess.ID))
+		pipe.SRem(ctx, userSessionsKey(sess.UserID), sess.ID)
+		return nil
+	})
+	return err
+}
+
+func (rs *RedisSessions) DestroyCurrent(w http.ResponseWriter, r *http.Request) error {
+	sess, err := SessionFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+	if err := rs.remove(r.Context(), sess); err != nil {
+		return err
+	}
+	ClearCookie(w)
+	return nil
+}
+
+func (rs *RedisSessions) Destroy(id string) error {
+	ctx := context.Background()
+	user, err := rs.client.HGet(ctx, sessionKey(id), "user").Int64()
+	if err == redis.Nil {
+		return ErrNoSession
+	}
+	if err != nil {
+		return err
+	}
+	return rs.remove(ctx, &Session{ID: id, UserID: user})
+}
+
+func (rs *RedisSessions) DestroyAll(userID int64) error {
+	ctx := context.Background()
+	return destroyAllScript.Run(ctx, rs.client, []string{userSessionsKey(userID)}, sessionKey("")).Err()
+}
+
+// List returns the live sessions of the user, the IDs of the sessions Redis
+// has already dropped are taken out of the set on the way.
+func (rs *RedisSessions) List(userID int64) ([]*Session, error) {
+	ctx := context.Background()
+	ids, err := rs.client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, sessionKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := []*Session{}
+	var gone []interface{}
+	for i, cmd := range cmds {
+		sess, err := parseSession(ids[i], cmd.Val())
+		if err == ErrNoAuth {
+			gone = append(gone, ids[i])
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !rs.Timeouts.Expired(sess, now) {
+			res = append(res, sess)
+		}
+	}
+	if len(gone) > 0 {
+		// the next List retries a failed cleanup
+		_ = rs.client.SRem(ctx, userSessionsKey(userID), gone...).Err()
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Created.Equal(res[j].Created) {
+			return res[i].Created.After(res[j].Created)
+		}
+		return res[i].ID > res[j].ID
+	})
+	return res, nil
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRedisSessions(t *testing.T) (*RedisSessions, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisSessions(client), mr
+}
+
+func TestRedisCreateGet(t *testing.T) {
+	rs, mr := newRedisSessions(t)
+	rs.Timeouts = Timeouts{MaxAge: 24 * time.Hour, IdleTimeout: time.Hour}
+
+	w := httptest.NewRecorder()
+	sess, err := rs.Create(w, 3, Client{UserAgent: "curl", IP: "1.2.3.4"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Set-Cookie"), "session_id="+sess.ID))
+	assert.InDelta(t, time.Hour, mr.TTL(sessionKey(sess.ID)), float64(time.Second))
+	assert.InDelta(t, 24*time.Hour, mr.TTL(userSessionsKey(3)), float64(time.Second))
+
+	got, err := rs.Get(sess.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), got.UserID)
+	assert.Equal(t, "curl", got.UserAgent)
+	assert.Equal(t, "1.2.3.4", got.IP)
+	assert.Equal(t, sess.Created.Unix(), got.Created.Unix())
+	assert.Equal(t, sess.RefreshHash, got.RefreshHash)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "session_id="+sess.ID)
+	got, err = rs.Check(req)
+	require.NoError(t, err)
+	assert.Equal(t, sess.ID, got.ID)
+
+	// the idle timeout is a TTL, Redis drops the session by itself
+	mr.FastForward(time.Hour)
+	_, err = rs.Get(sess.ID)
+	assert.Equal(t, ErrNoAuth, err)
+	_, err = rs.Check(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, ErrNoAuth, err)
+}
+
+func TestRedisTouch(t *testing.T) {
+	rs, mr := newRedisSessions(t)
+	rs.Timeouts = Timeouts{MaxAge: 24 * time.Hour, IdleTimeout: time.Hour}
+	sess, err := rs.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+
+	// a session seen long enough ago slides its expiry
+	lastSeen := time.Now().Add(-10 * time.Minute).Unix()
+	mr.HSet(sessionKey(sess.ID), "last_seen", strconv.FormatInt(lastSeen, 10))
+	mr.SetTTL(sessionKey(sess.ID), 50*time.Minute)
+	got, err := rs.Get(sess.ID)
+	require.NoError(t, err)
+	assert.True(t, got.LastSeen.Unix() > lastSeen)
+	assert.InDelta(t, time.Hour, mr.TTL(sessionKey(sess.ID)), float64(time.Second))
+	assert.Equal(t, strconv.FormatInt(got.LastSeen.Unix(), 10), mr.HGet(sessionKey(sess.ID), "last_seen"))
+
+	// a shorter max age applies to the sessions already stored
+	rs.Timeouts.MaxAge = 5 * time.Minute
+	mr.HSet(sessionKey(sess.ID), "created", strconv.FormatInt(lastSeen, 10))
+	_, err = rs.Get(sess.ID)
+	assert.Equal(t, ErrNoAuth, err)
+	assert.False(t, mr.Exists(sessionKey(sess.ID)))
+	ids, _ := mr.Members(userSessionsKey(3))
+	assert.Empty(t, ids)
+}
+
+func TestRedisRefresh(t *testing.T) {
+	rs, _ := newRedisSessions(t)
+	sess, err := rs.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+
+	rotated, err := rs.Refresh(sess.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, sess.RefreshToken, rotated.RefreshToken)
+	assert.True(t, SameRefreshHash(rotated.RefreshHash, rotated.RefreshToken))
+
+	// the old token destroys the session
+	_, err = rs.Refresh(sess.RefreshToken)
+	assert.Equal(t, ErrRefreshReused, err)
+	_, err = rs.Get(sess.ID)
+	assert.Equal(t, ErrNoAuth, err)
+	_, err = rs.Refresh(rotated.RefreshToken)
+	assert.Equal(t, ErrNoAuth, err)
+
+	_, err = rs.Refresh("junk")
+	assert.Equal(t, ErrNoAuth, err)
+}
+
+func TestRedisListDestroy(t *testing.T) {
+	rs, mr := newRedisSessions(t)
+	first, err := rs.Create(httptest.NewRecorder(), 3, Client{UserAgent: "first"})
+	require.NoError(t, err)
+	second, err := rs.Create(httptest.NewRecorder(), 3, Client{UserAgent: "second"})
+	require.NoError(t, err)
+	other, err := rs.Create(httptest.NewRecorder(), 4, Client{})
+	require.NoError(t, err)
+	stale, err := rs.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+	// as if Redis had expired it
+	mr.Del(sessionKey(stale.ID))
+
+	list, err := rs.List(3)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+	ids, _ := mr.Members(userSessionsKey(3))
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, ids)
+
+	assert.NoError(t, rs.Destroy(first.ID))
+	assert.Equal(t, ErrNoSession, rs.Destroy(first.ID))
+	list, err = rs.List(3)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "second", list[0].UserAgent)
+
+	// log out everywhere
+	third, err := rs.Create(httptest.NewRecorder(), 3, Client{})
+	require.NoError(t, err)
+	assert.NoError(t, rs.DestroyAll(3))
+	for _, id := range []string{second.ID, third.ID} {
+		_, err = rs.Get(id)
+		assert.Equal(t, ErrNoAuth, err)
+		assert.False(t, mr.Exists(sessionKey(id)))
+	}
+	assert.False(t, mr.Exists(userSessionsKey(3)))
+	list, err = rs.List(3)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	_, err = rs.Get(other.ID)
+	assert.NoError(t, err)
+
+	// the current session
+	req := httptest.NewRequest("POST", "/api/logout", nil)
+	req = req.WithContext(NewContext(req.Context(), other))
+	w := httptest.NewRecorder()
+	assert.NoError(t, rs.DestroyCurrent(w, req))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session_id=;")
+	_, err = rs.Get(other.ID)
+	assert.Equal(t, ErrNoAuth, err)
+}
+
+func TestRedisDown(t *testing.T) {
+	rs, mr := newRedisSessions(t)
+	mr.Close()
+	_, err := rs.Create(httptest.NewRecorder(), 3, Client{})
+	assert.Error(t, err)
+	_, err = rs.Get("abc")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNoAuth, err)
+}
@@ -1,7 +1,7 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: go
+// Source: session.go
 
-// Package post is a generated GoMock package.
+// Package session is a generated GoMock package.
 package session
 
 import (
@@ -50,18 +50,46 @@ func (mr *MockSessRepoMockRecorder) Check(r interface{}) *gomock.Call {
 }
 
 // Create mocks base method.
-func (m *MockSessRepo) Create(w http.ResponseWriter, userID int64) (*Session, error) {
+func (m *MockSessRepo) Create(w http.ResponseWriter, userID int64, client Client) (*Session, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", w, userID)
+	ret := m.ctrl.Call(m, "Create", w, userID, client)
 	ret0, _ := ret[0].(*Session)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockSessRepoMockRecorder) Create(w, userID interface{}) *gomock.Call {
+func (mr *MockSessRepoMockRecorder) Create(w, userID, client interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessRepo)(nil).Create), w, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessRepo)(nil).Create), w, userID, client)
+}
+
+// Destroy mocks base method.
+func (m *MockSessRepo) Destroy(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Destroy", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Destroy indicates an expected call of Destroy.
+func (mr *MockSessRepoMockRecorder) Destroy(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Destroy", reflect.TypeOf((*MockSessRepo)(nil).Destroy), id)
+}
+
+// DestroyAll mocks base method.
+func (m *MockSessRepo) DestroyAll(userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DestroyAll", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DestroyAll indicates an expected call of DestroyAll.
+func (mr *MockSessRepoMockRecorder) DestroyAll(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyAll", reflect.TypeOf((*MockSessRepo)(nil).DestroyAll), userID)
 }
 
 // DestroyCurrent mocks base method.
@@ -77,3 +105,48 @@ func (mr *MockSessRepoMockRecorder) DestroyCurrent(w, r interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyCurrent", reflect.TypeOf((*MockSessRepo)(nil).DestroyCurrent), w, r)
 }
+
+// Get mocks base method.
+func (m *MockSessRepo) Get(id string) (*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", id)
+	ret0, _ := ret[0].(*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockSessRepoMockRecorder) Get(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockSessRepo)(nil).Get), id)
+}
+
+// List mocks base method.
+func (m *MockSessRepo) List(userID int64) ([]*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", userID)
+	ret0, _ := ret[0].([]*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockSessRepoMockRecorder) List(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockSessRepo)(nil).List), userID)
+}
+
+// Refresh mocks base method.
+func (m *MockSessRepo) Refresh(token string) (*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", token)
+	ret0, _ := ret[0].(*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockSessRepoMockRecorder) Refresh(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockSessRepo)(nil).Refresh), token)
+}
@@ -1,52 +1,130 @@
 package session
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
 )
 
 type SessionsManager struct {
-	data *sql.DB
+	data     *sql.DB
+	Timeouts Timeouts
 }
 
 func NewSessionsRepo(db *sql.DB) *SessionsManager {
 	return &SessionsManager{data: db}
 }
+
+// Check finds the session of the cookie, see Get.
 func (sm *SessionsManager) Check(r *http.Request) (*Session, error) {
 	sessionCookie, err := r.Cookie("session_id")
 	if err == http.ErrNoCookie {
 		return nil, ErrNoAuth
 	}
+	return sm.Get(sessionCookie.Value)
+}
+
+func (sm *SessionsManager) Create(w http.ResponseWriter, userID int64, client Client) (*Session, error) {
+	sess := NewSession(userID, client)
+	sess.Expires = sm.Timeouts.Deadline(sess.Created, sess.LastSeen)
 
+	_, err := sm.data.Exec(
+		"INSERT INTO  sessions (`data`, `userID`, `refresh`, `created_at`, `user_agent`, `ip`, `last_seen`, `expires_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		sess.ID,
+		sess.UserID,
+		sess.RefreshHash,
+		sess.Created.Unix(),
+		sess.UserAgent,
+		sess.IP,
+		sess.LastSeen.Unix(),
+		sess.Expires.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	SetCookie(w, sess, sess.Created.Add(sm.Timeouts.maxAge()))
+	return sess, nil
+}
+
+// sessionColumns are read by scanSession, the times are in unix seconds so
+// that the DSN does not need parseTime.
+const sessionColumns = "data, userID, refresh, created_at, user_agent, ip, last_seen, expires_at"
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
 	sess := &Session{}
-	errD := sm.data.
-		QueryRow("SELECT data, userID FROM sessions WHERE data= ?", sessionCookie.Value).
-		Scan(&sess.ID, &sess.UserID)
-	if errD != nil {
-		return nil, ErrNoAuth
+	var created, lastSeen, expires int64
+	err := row.Scan(&sess.ID, &sess.UserID, &sess.RefreshHash, &created, &sess.UserAgent, &sess.IP, &lastSeen, &expires)
+	if err != nil {
+		return nil, err
 	}
+	sess.Created = time.Unix(created, 0)
+	sess.LastSeen = time.Unix(lastSeen, 0)
+	sess.Expires = time.Unix(expires, 0)
 	return sess, nil
 }
 
-func (sm *SessionsManager) Create(w http.ResponseWriter, userID int64) (*Session, error) {
-	sess := NewSession(userID)
+// Get returns the session while it is within its timeouts and slides its
+// expiry, an expired session is deleted on the spot.
+func (sm *SessionsManager) Get(id string) (*Session, error) {
+	sess, err := scanSession(sm.data.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE data = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNoAuth
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if sm.Timeouts.Expired(sess, now) {
+		if _, errD := sm.data.Exec("DELETE FROM sessions WHERE data = ?", id); errD != nil {
+			return nil, errD
+		}
+		return nil, ErrNoAuth
+	}
+	if sm.Timeouts.Touch(sess, now) {
+		// a failed write only leaves the old expiry in place
+		_, _ = sm.data.Exec(
+			"UPDATE sessions SET last_seen = ?, expires_at = ? WHERE data = ?",
+			sess.LastSeen.Unix(),
+			sess.Expires.Unix(),
+			id,
+		)
+	}
+	return sess, nil
+}
 
-	_, err := sm.data.Exec(
-		"INSERT INTO  sessions (`data`, `userID`) VALUES (?, ?)",
-		sess.ID,
-		sess.UserID,
+func (sm *SessionsManager) Refresh(token string) (*Session, error) {
+	id, err := SessionOfRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := sm.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !SameRefreshHash(sess.RefreshHash, token) {
+		if _, errD := sm.data.Exec("DELETE FROM sessions WHERE data = ?", id); errD != nil {
+			return nil, errD
+		}
+		return nil, ErrRefreshReused
+	}
+	newToken, newHash := NewRefreshToken(id)
+	// the old hash in the condition makes two concurrent refreshes with the
+	// same token rotate it only once
+	res, err := sm.data.Exec(
+		"UPDATE sessions SET refresh = ? WHERE data = ? AND refresh = ?",
+		newHash,
+		id,
+		sess.RefreshHash,
 	)
 	if err != nil {
 		return nil, err
 	}
-	cookie := &http.Cookie{
-		Name:    "session_id",
-		Value:   sess.ID,
-		Expires: time.Now().Add(90 * 24 * time.Hour),
-		Path:    "/",
+	if n, errN := res.RowsAffected(); errN != nil || n == 0 {
+		return nil, ErrRefreshReused
 	}
-	http.SetCookie(w, cookie)
+	sess.RefreshHash, sess.RefreshToken = newHash, newToken
 	return sess, nil
 }
 
@@ -64,11 +142,153 @@ func (sm *SessionsManager) DestroyCurrent(w http.ResponseWriter, r *http.Request
 		return errD
 	}
 
-	cookie := http.Cookie{
-		Name:    "session_id",
-		Expires: time.Now().AddDate(0, 0, -1),
-		Path:    "/",
+	ClearCookie(w)
+	return nil
+}
+
+func (sm *SessionsManager) Destroy(id string) error {
+	res, err := sm.data.Exec("DELETE FROM sessions WHERE data = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, errN := res.RowsAffected(); errN == nil && n == 0 {
+		return ErrNoSession
 	}
-	http.SetCookie(w, &cookie)
 	return nil
 }
+
+func (sm *SessionsManager) DestroyAll(userID int64) error {
+	_, err := sm.data.Exec("DELETE FROM sessions WHERE userID = ?", userID)
+	return err
+}
+
+func (sm *SessionsManager) List(userID int64) ([]*Session, error) {
+	rows, err := sm.data.Query(
+		"SELECT "+sessionColumns+" FROM sessions WHERE userID = ? AND expires_at > ? ORDER BY created_at DESC, id DESC",
+		userID,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []*Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sess)
+	}
+	return res, rows.Err()
+}
+
+// PurgeExpired deletes up to limit sessions that expired before now and
+// returns how many it deleted, see Janitor.
+func (sm *SessionsManager) PurgeExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	res, err := sm.data.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= ? LIMIT ?", now.Unix(), limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// sessionsDDL are the columns added to the sessions table since the first
+// release, in the order they were added.
+var sessionsDDL = []struct {
+	column, definition string
+}{
+	{"refresh", "char(64) NOT NULL DEFAULT ''"},
+	{"created_at", "bigint NOT NULL DEFAULT 0"},
+	{"user_agent", "varchar(255) NOT NULL DEFAULT ''"},
+	{"ip", "varchar(45) NOT NULL DEFAULT ''"},
+	{"last_seen", "bigint NOT NULL DEFAULT 0"},
+	{"expires_at", "bigint NOT NULL DEFAULT 0"},
+}
+
+// sessionsIndexes are the indexes of the sessions table: the session lookup
+// by id and the one of the janitor.
+var sessionsIndexes = []struct {
+	name, definition string
+	unique           bool
+}{
+	{"data", "UNIQUE INDEX `data` (`data`)", true},
+	{"expires_at", "INDEX `expires_at` (`expires_at`)", false},
+}
+
+// Migrate brings a sessions table of an older release up to date: it adds
+// the missing columns, turns the session id from TEXT into CHAR(32) so it
+// can be indexed, adds the missing indexes and gives the sessions stored
+// without an expiry a full idle timeout from now.
+func (sm *SessionsManager) Migrate(ctx context.Context) error {
+	columns, err := sm.schema(ctx,
+		"SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'sessions'")
+	if err != nil {
+		return err
+	}
+	for _, c := range sessionsDDL {
+		if _, ok := columns[c.column]; ok {
+			continue
+		}
+		_, err := sm.data.ExecContext(ctx, "ALTER TABLE sessions ADD COLUMN `"+c.column+"` "+c.definition)
+		if err != nil {
+			return fmt.Errorf("add column %s: %w", c.column, err)
+		}
+	}
+	if columns["data"] != "char" {
+		if _, err := sm.data.ExecContext(ctx, "ALTER TABLE sessions MODIFY `data` char(32) NOT NULL"); err != nil {
+			return fmt.Errorf("change column data: %w", err)
+		}
+	}
+
+	indexes, err := sm.schema(ctx,
+		"SELECT DISTINCT INDEX_NAME, NON_UNIQUE FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'sessions'")
+	if err != nil {
+		return err
+	}
+	for _, index := range sessionsIndexes {
+		nonUnique, ok := indexes[index.name]
+		if ok && (!index.unique || nonUnique == "0") {
+			continue
+		}
+		alter := "ALTER TABLE sessions ADD " + index.definition
+		if ok {
+			alter = "ALTER TABLE sessions DROP INDEX `" + index.name + "`, ADD " + index.definition
+		}
+		if _, err := sm.data.ExecContext(ctx, alter); err != nil {
+			return fmt.Errorf("add index %s: %w", index.name, err)
+		}
+	}
+
+	// MySQL assigns from left to right, expires_at sees the new created_at
+	now := time.Now().Unix()
+	_, err = sm.data.ExecContext(ctx,
+		"UPDATE sessions SET created_at = IF(created_at = 0, ?, created_at), last_seen = ?, "+
+			"expires_at = LEAST(created_at + ?, ?) WHERE expires_at = 0",
+		now,
+		now,
+		int64(sm.Timeouts.maxAge()/time.Second),
+		now+int64(sm.Timeouts.idleTimeout()/time.Second),
+	)
+	return err
+}
+
+// schema maps the names of the columns or the indexes of the sessions table
+// that the information_schema query returns to a detail of each.
+func (sm *SessionsManager) schema(ctx context.Context, query string) (map[string]string, error) {
+	rows, err := sm.data.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[string]string{}
+	for rows.Next() {
+		var name, detail string
+		if err := rows.Scan(&name, &detail); err != nil {
+			return nil, err
+		}
+		res[name] = detail
+	}
+	return res, rows.Err()
+}
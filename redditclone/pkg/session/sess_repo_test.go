@@ -0,0 +1,271 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var columns = []string{"data", "userID", "refresh", "created_at", "user_agent", "ip", "last_seen", "expires_at"}
+
+// live is a session row created an hour ago and seen just now.
+func live(rows *sqlmock.Rows, id string, userID int64, hash, agent, ip string) *sqlmock.Rows {
+	now := time.Now().Unix()
+	return rows.AddRow(id, userID, hash, now-3600, agent, ip, now, now+3600)
+}
+
+func TestRefreshToken(t *testing.T) {
+	token, hash := NewRefreshToken("abc")
+	assert.True(t, strings.HasPrefix(token, "abc."))
+	assert.True(t, SameRefreshHash(hash, token))
+	assert.False(t, SameRefreshHash(hash, token+"0"))
+
+	id, err := SessionOfRefreshToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", id)
+	for _, bad := range []string{"", "abc", ".abc", "abc."} {
+		_, err = SessionOfRefreshToken(bad)
+		assert.Equal(t, ErrNoAuth, err, bad)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	sm := NewSessionsRepo(db)
+	token, hash := NewRefreshToken("abc")
+	rows := func() *sqlmock.Rows {
+		return live(sqlmock.NewRows(columns), "abc", 3, hash, "curl", "1.2.3.4")
+	}
+
+	// the token is rotated
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("abc").WillReturnRows(rows())
+	mock.ExpectExec("UPDATE sessions SET refresh").
+		WithArgs(sqlmock.AnyArg(), "abc", hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sess, err := sm.Refresh(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sess.UserID)
+	assert.Equal(t, "curl", sess.UserAgent)
+	assert.Equal(t, time.Now().Unix()-3600, sess.Created.Unix())
+	assert.NotEqual(t, token, sess.RefreshToken)
+	assert.True(t, SameRefreshHash(sess.RefreshHash, sess.RefreshToken))
+
+	// a concurrent refresh rotated it first
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("abc").WillReturnRows(rows())
+	mock.ExpectExec("UPDATE sessions SET refresh").
+		WithArgs(sqlmock.AnyArg(), "abc", hash).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = sm.Refresh(token)
+	assert.Equal(t, ErrRefreshReused, err)
+
+	// an old token destroys the session
+	old, _ := NewRefreshToken("abc")
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("abc").WillReturnRows(rows())
+	mock.ExpectExec("DELETE FROM sessions WHERE").WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = sm.Refresh(old)
+	assert.Equal(t, ErrRefreshReused, err)
+
+	// the session is gone
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(columns))
+	_, err = sm.Refresh(token)
+	assert.Equal(t, ErrNoAuth, err)
+
+	_, err = sm.Refresh("garbage")
+	assert.Equal(t, ErrNoAuth, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateListDestroy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	sm := NewSessionsRepo(db)
+
+	mock.ExpectExec("INSERT INTO  sessions").
+		WithArgs(sqlmock.AnyArg(), int64(3), sqlmock.AnyArg(), sqlmock.AnyArg(), "curl", "1.2.3.4", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	w := httptest.NewRecorder()
+	sess, err := sm.Create(w, 3, Client{UserAgent: "curl", IP: "1.2.3.4"})
+	assert.NoError(t, err)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session_id="+sess.ID)
+	assert.NotEmpty(t, sess.RefreshToken)
+
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE userID = (.+) AND expires_at > (.+) ORDER BY created_at DESC").
+		WithArgs(int64(3), sqlmock.AnyArg()).
+		WillReturnRows(live(live(sqlmock.NewRows(columns), "new", 3, "h1", "curl", "1.2.3.4"), "old", 3, "h2", "firefox", "5.6.7.8"))
+	list, err := sm.List(3)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "old", list[1].ID)
+	assert.Equal(t, "firefox", list[1].UserAgent)
+	assert.NotEqual(t, list[0].PublicID(), list[1].PublicID())
+
+	mock.ExpectExec("DELETE FROM sessions WHERE data").WithArgs("old").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, sm.Destroy("old"))
+	mock.ExpectExec("DELETE FROM sessions WHERE data").WithArgs("old").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, ErrNoSession, sm.Destroy("old"))
+
+	mock.ExpectExec("DELETE FROM sessions WHERE userID").WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(t, sm.DestroyAll(3))
+	mock.ExpectExec("DELETE FROM sessions WHERE userID").WithArgs(int64(3)).WillReturnError(fmt.Errorf("bad query"))
+	assert.EqualError(t, sm.DestroyAll(3), "bad query")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTimeouts(t *testing.T) {
+	created := time.Date(2022, 5, 10, 13, 0, 0, 0, time.UTC)
+	tm := Timeouts{MaxAge: 10 * time.Hour, IdleTimeout: time.Hour}
+	assert.Equal(t, created.Add(time.Hour), tm.Deadline(created, created))
+	// the idle timeout can not stretch the session past its max age
+	assert.Equal(t, created.Add(10*time.Hour), tm.Deadline(created, created.Add(9*time.Hour+30*time.Minute)))
+
+	sess := &Session{Created: created, LastSeen: created, Expires: tm.Deadline(created, created)}
+	assert.False(t, tm.Expired(sess, created.Add(59*time.Minute)))
+	assert.True(t, tm.Expired(sess, created.Add(time.Hour)))
+
+	assert.False(t, tm.Touch(sess, created.Add(30*time.Second)))
+	assert.True(t, tm.Touch(sess, created.Add(30*time.Minute)))
+	assert.Equal(t, created.Add(90*time.Minute), sess.Expires)
+
+	// a max age lowered after the session was stored applies right away
+	sess.Expires = created.Add(100 * time.Hour)
+	assert.True(t, tm.Expired(sess, created.Add(10*time.Hour)))
+
+	assert.Equal(t, created.Add(DefaultIdleTimeout), Timeouts{}.Deadline(created, created))
+}
+
+func TestGetTimeouts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	sm := NewSessionsRepo(db)
+	sm.Timeouts = Timeouts{MaxAge: 24 * time.Hour, IdleTimeout: time.Hour}
+	now := time.Now().Unix()
+
+	// idle for too long
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("idle").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("idle", 3, "h", now-7200, "", "", now-3700, now-100))
+	mock.ExpectExec("DELETE FROM sessions WHERE data").WithArgs("idle").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = sm.Get("idle")
+	assert.Equal(t, ErrNoAuth, err)
+
+	// older than the max age however active
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("old").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("old", 3, "h", now-25*3600, "", "", now, now+3600))
+	mock.ExpectExec("DELETE FROM sessions WHERE data").WithArgs("old").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = sm.Get("old")
+	assert.Equal(t, ErrNoAuth, err)
+
+	// the activity slides the expiry
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("active").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("active", 3, "h", now-7200, "", "", now-600, now+3000))
+	mock.ExpectExec("UPDATE sessions SET last_seen = (.+), expires_at = (.+) WHERE data").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "active").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sess, err := sm.Get("active")
+	assert.NoError(t, err)
+	assert.InDelta(t, now+3600, sess.Expires.Unix(), 2)
+
+	// seen a moment ago, nothing is written
+	mock.ExpectQuery("SELECT (.+) FROM sessions WHERE data").WithArgs("fresh").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("fresh", 3, "h", now-7200, "", "", now-5, now+3595))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "fresh"})
+	sess, err = sm.Check(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "fresh", sess.ID)
+
+	_, err = sm.Check(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, ErrNoAuth, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	sm := NewSessionsRepo(db)
+	now := time.Now()
+
+	mock.ExpectExec("DELETE FROM sessions WHERE expires_at <= (.+) LIMIT").
+		WithArgs(now.Unix(), 100).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+	n, err := sm.PurgeExpired(context.Background(), now, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	sm := NewSessionsRepo(db)
+
+	// the table of the first release
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).
+			AddRow("id", "int").AddRow("data", "text").AddRow("userID", "text"))
+	for _, c := range sessionsDDL {
+		mock.ExpectExec("ALTER TABLE sessions ADD COLUMN `" + c.column + "`").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("ALTER TABLE sessions MODIFY `data` char\\(32\\) NOT NULL").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT DISTINCT INDEX_NAME, NON_UNIQUE FROM information_schema.STATISTICS").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "NON_UNIQUE"}).AddRow("PRIMARY", "0"))
+	mock.ExpectExec("ALTER TABLE sessions ADD UNIQUE INDEX `data`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE sessions ADD INDEX `expires_at`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sessions SET created_at = (.+) WHERE expires_at = 0").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), int64(DefaultMaxAge/time.Second), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, sm.Migrate(context.Background()))
+
+	// an up to date table is left alone
+	existing := func() *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).
+			AddRow("id", "int").AddRow("data", "char").AddRow("userID", "text")
+		for _, c := range sessionsDDL {
+			rows.AddRow(c.column, "bigint")
+		}
+		return rows
+	}
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS").WillReturnRows(existing())
+	mock.ExpectQuery("SELECT DISTINCT INDEX_NAME, NON_UNIQUE FROM information_schema.STATISTICS").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "NON_UNIQUE"}).
+			AddRow("PRIMARY", "0").AddRow("data", "0").AddRow("expires_at", "1"))
+	mock.ExpectExec("UPDATE sessions SET created_at = (.+) WHERE expires_at = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, sm.Migrate(context.Background()))
+
+	// a plain index of the session ids is made unique
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS").WillReturnRows(existing())
+	mock.ExpectQuery("SELECT DISTINCT INDEX_NAME, NON_UNIQUE FROM information_schema.STATISTICS").
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "NON_UNIQUE"}).AddRow("data", "1").AddRow("expires_at", "1"))
+	mock.ExpectExec("ALTER TABLE sessions DROP INDEX `data`, ADD UNIQUE INDEX `data`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE sessions SET created_at = (.+) WHERE expires_at = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, sm.Migrate(context.Background()))
+
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).AddRow("data", "text"))
+	mock.ExpectExec("ALTER TABLE sessions ADD COLUMN `refresh`").WillReturnError(fmt.Errorf("denied"))
+	assert.EqualError(t, sm.Migrate(context.Background()), "add column refresh: denied")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,34 +3,192 @@ package session
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type Session struct {
 	ID     string
 	UserID int64
+	// Created and the client are shown to the user in the list of sessions.
+	Created   time.Time
+	UserAgent string
+	IP        string
+	// LastSeen is the last activity written, Expires is when the session
+	// ends unless it is used again, see Timeouts.
+	LastSeen time.Time
+	Expires  time.Time
+	// RefreshHash is what is stored of the current refresh token, the token
+	// itself is only known to the client. RefreshToken is set by Create and
+	// Refresh to be handed out once.
+	RefreshHash  string
+	RefreshToken string
 }
 
-func NewSession(userID int64) *Session {
+// Client is the device a session is created for.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// MaxUserAgentLen is what is kept of the User-Agent header.
+const MaxUserAgentLen = 255
+
+const (
+	DefaultMaxAge      = 30 * 24 * time.Hour
+	DefaultIdleTimeout = 7 * 24 * time.Hour
+	// TouchInterval is how often the activity of a session is written, the
+	// idle timeout is only as precise as it.
+	TouchInterval = time.Minute
+)
+
+// Timeouts end a session MaxAge after it was created or IdleTimeout after it
+// was last used, whichever comes first. Zero fields take the defaults.
+type Timeouts struct {
+	MaxAge      time.Duration
+	IdleTimeout time.Duration
+}
+
+func (t Timeouts) maxAge() time.Duration {
+	if t.MaxAge <= 0 {
+		return DefaultMaxAge
+	}
+	return t.MaxAge
+}
+
+func (t Timeouts) idleTimeout() time.Duration {
+	if t.IdleTimeout <= 0 {
+		return DefaultIdleTimeout
+	}
+	return t.IdleTimeout
+}
+
+// Deadline is when a session created at created and last used at lastSeen
+// expires.
+func (t Timeouts) Deadline(created, lastSeen time.Time) time.Time {
+	absolute := created.Add(t.maxAge())
+	idle := lastSeen.Add(t.idleTimeout())
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// Expired also applies the current MaxAge to sessions stored with a longer
+// one.
+func (t Timeouts) Expired(sess *Session, now time.Time) bool {
+	return !now.Before(sess.Expires) || !now.Before(sess.Created.Add(t.maxAge()))
+}
+
+// Touch slides the expiry of sess to now. It reports false when the last
+// activity was written less than TouchInterval ago and nothing changed.
+func (t Timeouts) Touch(sess *Session, now time.Time) bool {
+	if now.Sub(sess.LastSeen) < TouchInterval {
+		return false
+	}
+	sess.LastSeen = now.Truncate(time.Second)
+	sess.Expires = t.Deadline(sess.Created, sess.LastSeen)
+	return true
+}
+
+// NewSession makes a session created now, the repos set its Expires with
+// their Timeouts.
+func NewSession(userID int64, client Client) *Session {
 	randID := make([]byte, 16)
 	rand.Read(randID)
-
-	return &Session{
-		ID:     fmt.Sprintf("%x", randID),
-		UserID: userID,
+	if len(client.UserAgent) > MaxUserAgentLen {
+		client.UserAgent = client.UserAgent[:MaxUserAgentLen]
+	}
+	now := time.Now().Truncate(time.Second)
+	sess := &Session{
+		ID:        fmt.Sprintf("%x", randID),
+		UserID:    userID,
+		Created:   now,
+		LastSeen:  now,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
 	}
+	sess.RefreshToken, sess.RefreshHash = NewRefreshToken(sess.ID)
+	return sess
+}
+
+// SetCookie gives the client the cookie of sess that lasts until expires.
+func SetCookie(w http.ResponseWriter, sess *Session, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    "session_id",
+		Value:   sess.ID,
+		Expires: expires,
+		Path:    "/",
+	})
+}
+
+// ClearCookie makes the client drop the session cookie.
+func ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    "session_id",
+		Expires: time.Now().AddDate(0, 0, -1),
+		Path:    "/",
+	})
+}
+
+// PublicID names the session in the list of sessions. The ID itself is the
+// value of the session cookie and is never shown.
+func (s *Session) PublicID() string {
+	sum := sha256.Sum256([]byte(s.ID))
+	return hex.EncodeToString(sum[:8])
 }
 
 var (
-	ErrNoAuth = errors.New("No session found")
+	ErrNoAuth        = errors.New("No session found")
+	ErrRefreshReused = errors.New("refresh token was already used")
+	ErrNoSession     = errors.New("session not found")
 )
 
+// NewRefreshToken makes a token of the session and the hash to store. The
+// token starts with the session ID so that a reused one can be traced back to
+// its session.
+func NewRefreshToken(sessID string) (token, hash string) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	token = sessID + "." + hex.EncodeToString(secret)
+	return token, HashRefreshToken(token)
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionOfRefreshToken returns the ID of the session the token was issued
+// for, it does not tell whether the token is still valid.
+func SessionOfRefreshToken(token string) (string, error) {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 || i == len(token)-1 {
+		return "", ErrNoAuth
+	}
+	return token[:i], nil
+}
+
+// SameRefreshHash compares the hashes in constant time.
+func SameRefreshHash(stored, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(HashRefreshToken(token))) == 1
+}
+
 type sessKey string
 
+// SessionKey is the context key of the session of the request token.
 var SessionKey sessKey = "sessionKey"
 
+func NewContext(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, SessionKey, sess)
+}
+
 func SessionFromContext(ctx context.Context) (*Session, error) {
 	sess, ok := ctx.Value(SessionKey).(*Session)
 	if !ok || sess == nil {
@@ -39,9 +197,22 @@ func SessionFromContext(ctx context.Context) (*Session, error) {
 	return sess, nil
 }
 
-//go:generate mockgen -source=session.go -destination=repo_mock.go -package=post SessRepo
+//go:generate mockgen -source=session.go -destination=repo_mock.go -package=session SessRepo
 type SessRepo interface {
-	Create(w http.ResponseWriter, userID int64) (*Session, error)
+	Create(w http.ResponseWriter, userID int64, client Client) (*Session, error)
+	// DestroyCurrent destroys the session of the request, see NewContext.
 	DestroyCurrent(w http.ResponseWriter, r *http.Request) error
+	// Destroy returns ErrNoSession when there is no such session.
+	Destroy(id string) error
+	DestroyAll(userID int64) error
+	// List returns the sessions of the user, the newest first.
+	List(userID int64) ([]*Session, error)
 	Check(r *http.Request) (*Session, error)
+	// Get returns the session of an access token, ErrNoAuth once it is
+	// destroyed.
+	Get(id string) (*Session, error)
+	// Refresh replaces the refresh token of its session with a new one. A
+	// token that was already replaced destroys the session: either the client
+	// or somebody who stole the token used it twice.
+	Refresh(token string) (*Session, error)
 }
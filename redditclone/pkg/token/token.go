@@ -0,0 +1,69 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"redditclone/pkg/user"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadToken = errors.New("bad auth token")
+)
+
+// Claims are what an access token tells about its bearer.
+type Claims struct {
+	User      *user.User
+	SessionID string
+}
+
+// Issue signs an access token of u in the session sessID that expires after
+// ttl. The user claim has the shape the frontend decodes.
+func Issue(secret []byte, u *user.User, sessID string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user": map[string]interface{}{
+			"username": u.Login,
+			"id":       u.ID,
+		},
+		"sid": sessID,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	})
+	return token.SignedString(secret)
+}
+
+// Parse validates a "Bearer <jwt>" header value signed with secret. Tokens
+// without a session are rejected, they could not be revoked.
+func Parse(secret []byte, header string) (*Claims, error) {
+	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
+		method, ok := token.Method.(*jwt.SigningMethodHMAC)
+		if !ok || method.Alg() != "HS256" {
+			return nil, fmt.Errorf("bad sign method")
+		}
+		return secret, nil
+	}
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 {
+		return nil, ErrBadToken
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(parts[1], claims, hashSecretGetter)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := claims["user"].(map[string]interface{})
+	if !ok {
+		return nil, ErrBadToken
+	}
+	login, okLogin := data["username"].(string)
+	id, okID := data["id"].(float64)
+	sessID, okSess := claims["sid"].(string)
+	if !okLogin || !okID || !okSess || sessID == "" {
+		return nil, ErrBadToken
+	}
+	return &Claims{User: &user.User{Login: login, ID: int64(id)}, SessionID: sessID}, nil
+}
@@ -0,0 +1,50 @@
+package token
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test secret of the tokens")
+
+func TestIssueParse(t *testing.T) {
+	u := &user.User{ID: 3, Login: "arin0", Password: "hash"}
+	tok, err := Issue(testSecret, u, "sess", time.Minute)
+	assert.NoError(t, err)
+
+	claims, err := Parse(testSecret, "Bearer "+tok)
+	assert.NoError(t, err)
+	assert.Equal(t, &Claims{User: &user.User{ID: 3, Login: "arin0"}, SessionID: "sess"}, claims)
+
+	_, err = Parse([]byte("other secret"), "Bearer "+tok)
+	assert.Error(t, err)
+	_, err = Parse(testSecret, tok)
+	assert.Equal(t, ErrBadToken, err)
+
+	expired, err := Issue(testSecret, u, "sess", -time.Minute)
+	assert.NoError(t, err)
+	_, err = Parse(testSecret, "Bearer "+expired)
+	assert.Error(t, err)
+}
+
+func TestParseWithoutSession(t *testing.T) {
+	// tokens issued before the sessions were checked can not be revoked
+	old, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user": map[string]interface{}{"username": "arin0", "id": 3},
+		"exp":  time.Now().Add(time.Minute).Unix(),
+	}).SignedString(testSecret)
+	assert.NoError(t, err)
+	_, err = Parse(testSecret, "Bearer "+old)
+	assert.Equal(t, ErrBadToken, err)
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"user": map[string]interface{}{"username": "arin0", "id": 3},
+		"sid":  "sess",
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+	_, err = Parse(testSecret, "Bearer "+none)
+	assert.Error(t, err)
+}
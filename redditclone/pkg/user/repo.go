@@ -1,64 +1,95 @@
 package user
 
 import (
-	"crypto/md5"
 	"errors"
-	"fmt"
+	"redditclone/pkg/password"
 	"sync"
 )
 
 var (
-	ErrNoUser  = errors.New("no user found")
-	ErrBadPass = errors.New("invalid Password")
+	ErrNoUser     = errors.New("no user found")
+	ErrBadPass    = errors.New("invalid Password")
+	ErrUserExists = errors.New("user already exists")
 )
 
+// UserMemoryRepository keeps the users in memory. Passwords are hashed and
+// checked outside the lock, a slow hash does not hold up the other requests.
 type UserMemoryRepository struct {
 	LastIndex int
 	data      map[string]*User
+	byID      map[int64]*User
 	mutex     sync.Mutex
+	// Hasher hashes new passwords, password.Default when nil.
+	Hasher *password.Hasher
 }
 
 func NewMemoryRepo() *UserMemoryRepository {
 	return &UserMemoryRepository{
 		data: make(map[string]*User),
+		byID: make(map[int64]*User),
 	}
 }
 
+// Authorize checks the password against the stored hash. Legacy hashes and
+// hashes made with other settings are replaced after a successful login.
 func (repo *UserMemoryRepository) Authorize(login, pass string) (*User, error) {
+	repo.mutex.Lock()
 	u, ok := repo.data[login]
-	pass = CodingPass(pass)
+	var res User
+	if ok {
+		res = *u
+	}
+	repo.mutex.Unlock()
 	if !ok {
 		return nil, ErrNoUser
 	}
-	if u.Password != pass {
+	rehash, err := repo.Hasher.Verify(res.Password, pass)
+	if err != nil {
 		return nil, ErrBadPass
 	}
-	return u, nil
+	if rehash {
+		if hash, err := repo.Hasher.Hash(pass); err == nil {
+			repo.mutex.Lock()
+			// a concurrent login may have rehashed it first
+			if u.Password == res.Password {
+				u.Password = hash
+			}
+			res.Password = u.Password
+			repo.mutex.Unlock()
+		}
+	}
+	return &res, nil
 }
 
-func (repo *UserMemoryRepository) AddUserInRepo(login, pass string) (*User, error) {
-	pass = CodingPass(pass)
+func (repo *UserMemoryRepository) GetByID(id int64) (*User, error) {
 	repo.mutex.Lock()
-	repo.data[login] = &User{
-		Login:    login,
-		Password: pass,
-		ID:       int64(repo.LastIndex),
-	}
-	repo.LastIndex++
-	repo.mutex.Unlock()
-	u, ok := repo.data[login]
+	defer repo.mutex.Unlock()
+	u, ok := repo.byID[id]
 	if !ok {
 		return nil, ErrNoUser
 	}
-	if u.Password != pass {
-		return nil, ErrBadPass
-	}
-	return u, nil
+	res := *u
+	return &res, nil
 }
 
-func CodingPass(data string) string {
-	DataSignerSalt := ""
-	data += DataSignerSalt
-	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
-	return dataHash
+func (repo *UserMemoryRepository) AddUserInRepo(login, pass string) (*User, error) {
+	hash, err := repo.Hasher.Hash(pass)
+	if err != nil {
+		return nil, err
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[login]; ok {
+		return nil, ErrUserExists
+	}
+	u := &User{
+		Login:    login,
+		Password: hash,
+		ID:       int64(repo.LastIndex),
+	}
+	repo.data[login] = u
+	repo.byID[u.ID] = u
+	repo.LastIndex++
+	res := *u
+	return &res, nil
 }
@@ -2,44 +2,91 @@ package user
 
 import (
 	"database/sql"
+	"errors"
+	"log"
+	"redditclone/pkg/password"
 )
 
 type UserMysqlRepository struct {
 	DB *sql.DB
+	// Hasher hashes new passwords, password.Default when nil.
+	Hasher *password.Hasher
 }
 
 func NewMysqlRepo(db *sql.DB) *UserMysqlRepository {
 	return &UserMysqlRepository{DB: db}
 }
 
+// Authorize checks the password against the stored hash. Legacy hashes and
+// hashes made with other settings are replaced after a successful login.
 func (repo *UserMysqlRepository) Authorize(login, pass string) (*User, error) {
 	u := &User{}
 	err := repo.DB.
 		QueryRow("SELECT id, login, password FROM users WHERE login = ?", login).
 		Scan(&u.ID, &u.Login, &u.Password)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrNoUser
 	}
-	//pass = CodingPass(u.Password)
-	if u.Password != pass {
+	// a database failure is not a wrong login
+	if err != nil {
+		return nil, err
+	}
+	rehash, err := repo.Hasher.Verify(u.Password, pass)
+	if err != nil {
 		return nil, ErrBadPass
 	}
+	if rehash {
+		repo.rehash(u, pass)
+	}
+	return u, nil
+}
+
+// rehash stores a fresh hash of the password, a failure only leaves the old
+// hash in place until the next login.
+func (repo *UserMysqlRepository) rehash(u *User, pass string) {
+	hash, err := repo.Hasher.Hash(pass)
+	if err != nil {
+		log.Println("err in rehash password:", err)
+		return
+	}
+	_, err = repo.DB.Exec("UPDATE users SET password = ? WHERE id = ?", hash, u.ID)
+	if err != nil {
+		log.Println("err in rehash password:", err)
+		return
+	}
+	u.Password = hash
+}
+
+func (repo *UserMysqlRepository) GetByID(id int64) (*User, error) {
+	u := &User{}
+	err := repo.DB.
+		QueryRow("SELECT id, login, password FROM users WHERE id = ?", id).
+		Scan(&u.ID, &u.Login, &u.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoUser
+	}
+	if err != nil {
+		return nil, err
+	}
 	return u, nil
 }
 
 func (repo *UserMysqlRepository) AddUserInRepo(login, pass string) (*User, error) {
-	//pass = CodingPass(pass)
+	hash, err := repo.Hasher.Hash(pass)
+	if err != nil {
+		return nil, err
+	}
 	result, err := repo.DB.Exec(
 		"INSERT INTO users (`login`, `password`) VALUES (?, ?)",
 		login,
-		pass,
+		hash,
 	)
 	if err != nil {
 		return nil, err
 	}
 	us := &User{
 		Login:    login,
-		Password: pass,
+		Password: hash,
 	}
 	us.ID, _ = result.LastInsertId()
 	return us, nil
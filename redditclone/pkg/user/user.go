@@ -1,13 +1,29 @@
 package user
 
+import "context"
+
 type User struct {
 	ID       int64  `json:"id" bson:"id"`
 	Login    string `json:"username" bson:"login"`
 	Password string
 }
 
+type userKey string
+
+// UserKey is the context key of the user authenticated by the request token.
+var UserKey userKey = "userKey"
+
+func UserFromContext(ctx context.Context) (*User, error) {
+	u, ok := ctx.Value(UserKey).(*User)
+	if !ok || u == nil {
+		return nil, ErrNoUser
+	}
+	return u, nil
+}
+
 //go:generate mockgen -source=user.go -destination=repo_mock.go -package=user UserRepo
 type UserRepo interface {
 	Authorize(login, pass string) (*User, error)
 	AddUserInRepo(login, pass string) (*User, error)
+	GetByID(id int64) (*User, error)
 }
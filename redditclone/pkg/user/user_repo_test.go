@@ -2,12 +2,19 @@ package user
 
 import (
 	"fmt"
+	"github.com/stretchr/testify/assert"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
-	"reflect"
+	"redditclone/pkg/password"
+	"strings"
+	"sync"
 	"testing"
 )
 
-// cd
+// testHasher keeps the argon2 costs low so the tests run quickly.
+var testHasher = &password.Hasher{
+	Algorithm: password.Argon2id,
+	Argon2:    password.Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+}
 
 func TestAuthorize(t *testing.T) {
 	db, mock, err := sqlmock.New()
@@ -33,8 +40,15 @@ func TestAuthorize(t *testing.T) {
 		WithArgs(login).
 		WillReturnRows(rows)
 
+	// the legacy plain text password is replaced by a hash
+	mock.
+		ExpectExec("UPDATE users SET password").
+		WithArgs(sqlmock.AnyArg(), elemID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
 	repo := &UserMysqlRepository{
-		DB: db,
+		DB:     db,
+		Hasher: testHasher,
 	}
 
 	item, err := repo.Authorize(login, password)
@@ -46,11 +60,31 @@ func TestAuthorize(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 		return
 	}
-	if !reflect.DeepEqual(item, expect[0]) {
+	if item.ID != elemID || item.Login != login || !strings.HasPrefix(item.Password, "$argon2id$") {
 		t.Errorf("results not match, want %v, have %v", expect[0], item)
 		return
 	}
 
+	// an up to date hash is left as it is
+	hash := item.Password
+	mock.
+		ExpectQuery("SELECT id, login, password FROM  users WHERE").
+		WithArgs(login).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "login", "password"}).AddRow(elemID, login, hash))
+	item, err = repo.Authorize(login, password)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+		return
+	}
+	if item.Password != hash {
+		t.Errorf("hash changed: want %v, have %v", hash, item.Password)
+		return
+	}
+
 	// BabPass error
 	badPass := "lol"
 	for _, item := range expect {
@@ -85,8 +119,20 @@ func TestAuthorize(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 		return
 	}
-	if err == nil {
-		t.Errorf("expected error, got nil")
+	if err == nil || err == ErrNoUser {
+		t.Errorf("expected the db error, got %v", err)
+		return
+	}
+
+	// no such user
+	mock.
+		ExpectQuery("SELECT id, login, password FROM  users WHERE").
+		WithArgs(login).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "login", "password"}))
+
+	_, err = repo.Authorize(login, password)
+	if err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
 		return
 	}
 
@@ -119,7 +165,8 @@ func TestCreate(t *testing.T) {
 	defer db.Close()
 
 	repo := &UserMysqlRepository{
-		DB: db,
+		DB:     db,
+		Hasher: testHasher,
 	}
 
 	login := "Athin"
@@ -128,7 +175,7 @@ func TestCreate(t *testing.T) {
 	//ok query
 	mock.
 		ExpectExec(`INSERT INTO users`).
-		WithArgs(login, pass).
+		WithArgs(login, sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	id, err := repo.AddUserInRepo(login, pass)
@@ -140,6 +187,10 @@ func TestCreate(t *testing.T) {
 		t.Errorf("bad id: want %v, have %v", id, 1)
 		return
 	}
+	if _, err := testHasher.Verify(id.Password, pass); err != nil || id.Password == pass {
+		t.Errorf("password is not hashed: %v", id.Password)
+		return
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -148,7 +199,7 @@ func TestCreate(t *testing.T) {
 	// query error
 	mock.
 		ExpectExec(`INSERT INTO users`).
-		WithArgs(login, pass).
+		WithArgs(login, sqlmock.AnyArg()).
 		WillReturnError(fmt.Errorf("bad query"))
 
 	_, err = repo.AddUserInRepo(login, pass)
@@ -163,7 +214,7 @@ func TestCreate(t *testing.T) {
 	// result error
 	mock.
 		ExpectExec(`INSERT INTO users`).
-		WithArgs(login, pass).
+		WithArgs(login, sqlmock.AnyArg()).
 		WillReturnError(fmt.Errorf("bad_result"))
 
 	_, err = repo.AddUserInRepo(login, pass)
@@ -175,3 +226,105 @@ func TestCreate(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestMemoryRepo(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.Hasher = testHasher
+
+	u, err := repo.AddUserInRepo("Athin", "asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u.Password, "$argon2id$"))
+
+	res, err := repo.Authorize("Athin", "asdfghjk")
+	assert.NoError(t, err)
+	assert.Equal(t, u, res)
+
+	_, err = repo.Authorize("Athin", "lol")
+	assert.Equal(t, ErrBadPass, err)
+	_, err = repo.Authorize("nobody", "asdfghjk")
+	assert.Equal(t, ErrNoUser, err)
+
+	// md5 hashes of the old memory repo are upgraded on login
+	repo.data["old"] = &User{ID: 7, Login: "old", Password: "bf709005906087dc1256bb4449d8774d"}
+	repo.byID[7] = repo.data["old"]
+	res, err = repo.Authorize("old", "asdfghjk")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.Password, "$argon2id$"))
+	assert.Equal(t, res.Password, repo.data["old"].Password)
+
+	_, err = repo.AddUserInRepo("Athin", "qwertyui")
+	assert.Equal(t, ErrUserExists, err)
+	res, err = repo.Authorize("Athin", "asdfghjk")
+	assert.NoError(t, err)
+	assert.Equal(t, u, res)
+}
+
+func TestMemoryRepoConcurrent(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.Hasher = testHasher
+	var wg sync.WaitGroup
+	ids := make(chan int64, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			login := fmt.Sprintf("user%d", i%10)
+			if u, err := repo.AddUserInRepo(login, "asdfghjk"); err == nil {
+				ids <- u.ID
+			}
+			_, _ = repo.Authorize(login, "asdfghjk")
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+	seen := map[int64]bool{}
+	for id := range ids {
+		assert.False(t, seen[id], "id %d given twice", id)
+		seen[id] = true
+		_, err := repo.GetByID(id)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, seen, 10)
+}
+
+func TestGetByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := &UserMysqlRepository{DB: db}
+
+	mock.
+		ExpectQuery("SELECT id, login, password FROM users WHERE id").
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "login", "password"}).AddRow(5, "Athin", "hash"))
+	u, err := repo.GetByID(5)
+	assert.NoError(t, err)
+	assert.Equal(t, &User{ID: 5, Login: "Athin", Password: "hash"}, u)
+
+	mock.
+		ExpectQuery("SELECT id, login, password FROM users WHERE id").
+		WithArgs(int64(6)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "login", "password"}))
+	_, err = repo.GetByID(6)
+	assert.Equal(t, ErrNoUser, err)
+
+	mock.
+		ExpectQuery("SELECT id, login, password FROM users WHERE id").
+		WithArgs(int64(7)).
+		WillReturnError(fmt.Errorf("bad query"))
+	_, err = repo.GetByID(7)
+	assert.EqualError(t, err, "bad query")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mem := NewMemoryRepo()
+	mem.Hasher = testHasher
+	added, err := mem.AddUserInRepo("Athin", "asdfghjk")
+	assert.NoError(t, err)
+	u, err = mem.GetByID(added.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, added, u)
+	_, err = mem.GetByID(100)
+	assert.Equal(t, ErrNoUser, err)
+}
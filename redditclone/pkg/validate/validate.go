@@ -0,0 +1,134 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"redditclone/pkg/apierror"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule checks a value and returns what is wrong with it, "" if nothing is.
+type Rule func(value string) string
+
+// Check is a field of a request together with its rules. The rules are tried
+// in order and only the first failing one is reported, so a missing field is
+// not also reported as too short.
+type Check struct {
+	Param  string
+	Value  string
+	Rules  []Rule
+	secret bool
+	skip   bool
+}
+
+// Field checks value with rules, the value is echoed back in the error.
+func Field(param, value string, rules ...Rule) Check {
+	return Check{Param: param, Value: value, Rules: rules}
+}
+
+// Secret is a Field whose value is never put into the error, for passwords.
+func Secret(param, value string, rules ...Rule) Check {
+	return Check{Param: param, Value: value, Rules: rules, secret: true}
+}
+
+// When makes the check apply only if cond holds, for rules that depend on
+// another field like the url of a link post.
+func (c Check) When(cond bool) Check {
+	c.skip = c.skip || !cond
+	return c
+}
+
+// Run reports every failing field of the request at location ("body",
+// "query"...), nil when all of them are valid.
+func Run(location string, checks ...Check) []apierror.FieldError {
+	var errs []apierror.FieldError
+	for _, c := range checks {
+		if c.skip {
+			continue
+		}
+		for _, rule := range c.Rules {
+			msg := rule(c.Value)
+			if msg == "" {
+				continue
+			}
+			fe := apierror.FieldError{Location: location, Param: c.Param, Msg: msg}
+			if !c.secret {
+				fe.Value = c.Value
+			}
+			errs = append(errs, fe)
+			break
+		}
+	}
+	return errs
+}
+
+// Required fails on empty and whitespace only values.
+func Required(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "is required"
+	}
+	return ""
+}
+
+// MinLen and MaxLen count characters, not bytes.
+func MinLen(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) < n {
+			return fmt.Sprintf("must be at least %d characters long", n)
+		}
+		return ""
+	}
+}
+
+func MaxLen(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) > n {
+			return fmt.Sprintf("must be at most %d characters long", n)
+		}
+		return ""
+	}
+}
+
+// MaxBytes is for values with a limit in bytes, bcrypt ignores everything
+// after the 72nd byte of a password.
+func MaxBytes(n int) Rule {
+	return func(value string) string {
+		if len(value) > n {
+			return fmt.Sprintf("must be at most %d bytes long", n)
+		}
+		return ""
+	}
+}
+
+// OneOf accepts only the listed values.
+func OneOf(allowed ...string) Rule {
+	return func(value string) string {
+		for _, a := range allowed {
+			if value == a {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(allowed, ", ")
+	}
+}
+
+// Match accepts the values matching re, msg says what they look like.
+func Match(re *regexp.Regexp, msg string) Rule {
+	return func(value string) string {
+		if !re.MatchString(value) {
+			return msg
+		}
+		return ""
+	}
+}
+
+// URL accepts absolute http and https URLs with a host.
+func URL(value string) string {
+	u, err := url.ParseRequestURI(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "must be a valid http or https URL"
+	}
+	return ""
+}
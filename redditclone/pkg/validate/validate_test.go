@@ -0,0 +1,45 @@
+package validate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/apierror"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	errs := Run("body",
+		Field("title", "  ", Required, MaxLen(5)),
+		Field("category", "cats", Required, OneOf("music", "news")),
+		Field("url", "not a url", URL).When(false),
+		Secret("password", "short", Required, MinLen(8)),
+		Field("ok", "fine", Required),
+	)
+	assert.Equal(t, []apierror.FieldError{
+		{Location: "body", Param: "title", Msg: "is required", Value: "  "},
+		{Location: "body", Param: "category", Msg: "must be one of music, news", Value: "cats"},
+		{Location: "body", Param: "password", Msg: "must be at least 8 characters long"},
+	}, errs)
+
+	assert.Nil(t, Run("body", Field("title", "hello", Required, MaxLen(5))))
+}
+
+func TestRules(t *testing.T) {
+	assert.Equal(t, "", MaxLen(2)("яя"))
+	assert.NotEqual(t, "", MaxLen(2)("яяя"))
+	assert.Equal(t, "", MinLen(2)("яя"))
+	assert.NotEqual(t, "", MaxBytes(2)("яя"))
+	assert.Equal(t, "", MaxBytes(72)(strings.Repeat("a", 72)))
+
+	word := Match(regexp.MustCompile(`^\w*$`), "must be a word")
+	assert.Equal(t, "", word("abc"))
+	assert.Equal(t, "must be a word", word("a b"))
+
+	for _, good := range []string{"http://a.ru", "https://example.com/path?q=1"} {
+		assert.Equal(t, "", URL(good), good)
+	}
+	for _, bad := range []string{"", "example.com", "ftp://a.ru", "http://", "javascript:alert(1)", "/relative"} {
+		assert.NotEqual(t, "", URL(bad), bad)
+	}
+}
@@ -0,0 +1,59 @@
+package views
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultWindow is how long repeated views of a post by the same viewer are
+// counted once.
+const DefaultWindow = 30 * time.Minute
+
+// Tracker remembers who has recently viewed which post. A nil Tracker or one
+// with a zero window counts every view.
+type Tracker struct {
+	window    time.Duration
+	mutex     sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewTracker(window time.Duration) *Tracker {
+	return &Tracker{
+		window: window,
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Count reports whether the view of the post by viewer has to be counted,
+// that is the viewer has not seen the post within the window.
+func (t *Tracker) Count(postID, viewer string) bool {
+	if t == nil || t.window <= 0 {
+		return true
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	if now.Sub(t.lastSweep) > t.window {
+		t.sweep(now)
+	}
+	key := postID + "\x00" + viewer
+	if last, ok := t.seen[key]; ok && now.Sub(last) < t.window {
+		return false
+	}
+	t.seen[key] = now
+	return true
+}
+
+// sweep forgets the views older than the window so the map does not grow
+// forever.
+func (t *Tracker) sweep(now time.Time) {
+	for key, last := range t.seen {
+		if now.Sub(last) >= t.window {
+			delete(t.seen, key)
+		}
+	}
+	t.lastSweep = now
+}
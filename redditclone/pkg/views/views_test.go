@@ -0,0 +1,27 @@
+package views
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCount(t *testing.T) {
+	now := time.Date(2022, 5, 10, 13, 0, 0, 0, time.UTC)
+	tr := NewTracker(time.Minute)
+	tr.now = func() time.Time { return now }
+
+	assert.True(t, tr.Count("1", "user:arin0"))
+	assert.False(t, tr.Count("1", "user:arin0"))
+	assert.True(t, tr.Count("2", "user:arin0"))
+	assert.True(t, tr.Count("1", "addr:127.0.0.1"))
+
+	now = now.Add(2 * time.Minute)
+	assert.True(t, tr.Count("1", "user:arin0"))
+	assert.Len(t, tr.seen, 1)
+
+	var off *Tracker
+	assert.True(t, off.Count("1", "user:arin0"))
+	assert.True(t, off.Count("1", "user:arin0"))
+	assert.True(t, NewTracker(0).Count("1", "user:arin0"))
+}
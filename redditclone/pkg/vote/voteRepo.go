@@ -9,8 +9,8 @@ import (
 var ErrBadVote = errors.New("Bab vote number for Vote")
 
 type VoteMemoryRepo struct {
-	num   int     `bson:"num" json:"num"`
-	data  []*Vote `json:"data" bson:"data"`
+	num   int
+	data  []*Vote
 	mutex sync.Mutex
 }
 
@@ -86,13 +86,10 @@ func MakeVoteArr(c []Vote, coin int, user *user.User) ([]Vote, error) {
 	return c, nil
 }
 func DeleteArr(c []Vote, user *user.User) []Vote {
-	var k int
 	for i, item := range c {
 		if item.User == user.ID {
-			k = i
-			break
+			return append(c[:i], c[i+1:]...)
 		}
 	}
-	c = append(c[:k], c[k+1:]...)
 	return c
 }